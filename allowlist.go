@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/wavesplatform/gowaves/pkg/proto"
+)
+
+// loadAllowlist reads recipients from the file, one address or alias per line.
+// Empty lines and lines starting with '#' are skipped.
+func loadAllowlist(path string) ([]proto.Recipient, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	var r []proto.Recipient
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		s := strings.TrimSpace(sc.Text())
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		rcp, err := parseRecipient(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient '%s' on line %d: %w", s, n, err)
+		}
+		r = append(r, rcp)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(r) == 0 {
+		return nil, fmt.Errorf("no recipients in file '%s'", path)
+	}
+	return r, nil
+}
+
+// notAllowed returns the first of recipients that is not in the allowlist. Aliases are resolved on node,
+// so an address is allowed by its alias and vice versa.
+func notAllowed(ctx context.Context, cl *node, allowlist, recipients []proto.Recipient) (*proto.Recipient, error) {
+	resolve := func(rcp proto.Recipient) (proto.WavesAddress, error) {
+		if rcp.Address != nil {
+			return *rcp.Address, nil
+		}
+		addr, _, err := cl.Alias.Get(ctx, rcp.Alias.Alias)
+		if err != nil {
+			return proto.WavesAddress{}, fmt.Errorf("failed to resolve alias '%s': %w", rcp.String(), err)
+		}
+		return addr, nil
+	}
+	allowed := make(map[proto.WavesAddress]bool, len(allowlist))
+	for _, rcp := range allowlist {
+		addr, err := resolve(rcp)
+		if err != nil {
+			return nil, err
+		}
+		allowed[addr] = true
+	}
+	for i := range recipients {
+		addr, err := resolve(recipients[i])
+		if err != nil {
+			return nil, err
+		}
+		if !allowed[addr] {
+			return &recipients[i], nil
+		}
+	}
+	return nil, nil
+}
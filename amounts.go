@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/oguzbilgic/fpd"
+)
+
+const wavesDecimals = 8
+
+var (
+	errOverflow  = errors.New("amount overflow")
+	errUnderflow = errors.New("amount underflow")
+)
+
+func addAmounts(a, b uint64) (uint64, error) {
+	s := a + b
+	if s < a {
+		return 0, fmt.Errorf("%w: %d + %d", errOverflow, a, b)
+	}
+	return s, nil
+}
+
+func subAmounts(a, b uint64) (uint64, error) {
+	if b > a {
+		return 0, fmt.Errorf("%w: %d - %d", errUnderflow, a, b)
+	}
+	return a - b, nil
+}
+
+// deduct subtracts the reserve from the balance down to zero.
+func deduct(balance, reserve uint64) uint64 {
+	if reserve >= balance {
+		return 0
+	}
+	return balance - reserve
+}
+
+// percentOf returns the percent of the value rounded down, percent must be in range from 0 to 100.
+func percentOf(v uint64, percent int) uint64 {
+	hi, lo := bits.Mul64(v, uint64(percent))
+	q, _ := bits.Div64(hi, lo, 100)
+	return q
+}
+
+// amount is a flag value in WAVELETS that also accepts decimal WAVES, for example "1.5".
+type amount int64
+
+func (a *amount) String() string {
+	return strconv.FormatInt(int64(*a), 10)
+}
+
+func (a *amount) Set(s string) error {
+	v, err := parseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = amount(v)
+	return nil
+}
+
+func parseAmount(s string) (int64, error) {
+	i := strings.IndexByte(s, '.')
+	if i < 0 {
+		return strconv.ParseInt(s, 10, 64)
+	}
+	integer, fraction := s[:i], s[i+1:]
+	if len(fraction) > wavesDecimals {
+		return 0, fmt.Errorf("more than %d decimal places in '%s'", wavesDecimals, s)
+	}
+	if strings.HasPrefix(integer, "-") || strings.HasPrefix(integer, "+") || strings.ContainsAny(fraction, "+-") {
+		return 0, fmt.Errorf("invalid amount of WAVES '%s'", s)
+	}
+	d, err := fpd.NewFromString(integer+fraction, -len(fraction))
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount of WAVES '%s': %w", s, err)
+	}
+	v, err := strconv.ParseInt(d.StringScaled(-wavesDecimals), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("amount of WAVES '%s' is out of range", s)
+	}
+	return v, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestAddAmounts(t *testing.T) {
+	tests := []struct {
+		a, b uint64
+		want uint64
+		err  error
+	}{
+		{0, 0, 0, nil},
+		{waves, standardFee, waves + standardFee, nil},
+		{math.MaxUint64 - 1, 1, math.MaxUint64, nil},
+		{math.MaxUint64, 0, math.MaxUint64, nil},
+		{math.MaxUint64, 1, 0, errOverflow},
+		{1, math.MaxUint64, 0, errOverflow},
+		{math.MaxUint64, math.MaxUint64, 0, errOverflow},
+		{math.MaxUint64 - standardFee + 1, standardFee, 0, errOverflow},
+	}
+	for _, tc := range tests {
+		got, err := addAmounts(tc.a, tc.b)
+		if !errors.Is(err, tc.err) || got != tc.want {
+			t.Errorf("addAmounts(%d, %d) = %d, %v; want %d, %v", tc.a, tc.b, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestSubAmounts(t *testing.T) {
+	tests := []struct {
+		a, b uint64
+		want uint64
+		err  error
+	}{
+		{0, 0, 0, nil},
+		{waves, standardFee, waves - standardFee, nil},
+		{standardFee, standardFee, 0, nil},
+		{standardFee - 1, standardFee, 0, errUnderflow}, // Fee is bigger than balance
+		{0, 1, 0, errUnderflow},
+		{math.MaxUint64, math.MaxUint64, 0, nil},
+		{math.MaxUint64, 1, math.MaxUint64 - 1, nil},
+		{math.MaxUint64 - 1, math.MaxUint64, 0, errUnderflow},
+	}
+	for _, tc := range tests {
+		got, err := subAmounts(tc.a, tc.b)
+		if !errors.Is(err, tc.err) || got != tc.want {
+			t.Errorf("subAmounts(%d, %d) = %d, %v; want %d, %v", tc.a, tc.b, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestDeduct(t *testing.T) {
+	tests := []struct {
+		balance, reserve uint64
+		want             uint64
+	}{
+		{0, 0, 0},
+		{waves, 0, waves},
+		{waves, waves, 0},
+		{waves, waves + 1, 0},
+		{standardFee, 2 * standardFee, 0}, // Fee is bigger than balance
+		{math.MaxUint64, 1, math.MaxUint64 - 1},
+		{math.MaxUint64, math.MaxUint64, 0},
+		{1, math.MaxUint64, 0},
+	}
+	for _, tc := range tests {
+		if got := deduct(tc.balance, tc.reserve); got != tc.want {
+			t.Errorf("deduct(%d, %d) = %d, want %d", tc.balance, tc.reserve, got, tc.want)
+		}
+	}
+}
+
+func TestPercentOf(t *testing.T) {
+	tests := []struct {
+		v       uint64
+		percent int
+		want    uint64
+	}{
+		{waves, 100, waves},
+		{waves, 50, waves / 2},
+		{99, 50, 49},
+		{waves, 0, 0},
+		{math.MaxUint64, 100, math.MaxUint64},
+		{math.MaxUint64, 50, math.MaxUint64 / 2},
+	}
+	for _, tc := range tests {
+		if got := percentOf(tc.v, tc.percent); got != tc.want {
+			t.Errorf("percentOf(%d, %d) = %d, want %d", tc.v, tc.percent, got, tc.want)
+		}
+	}
+}
+
+func TestTotalLeased(t *testing.T) {
+	tests := []struct {
+		amounts []uint64
+		want    uint64
+		err     error
+	}{
+		{nil, 0, nil},
+		{[]uint64{waves, 2 * waves}, 3 * waves, nil},
+		{[]uint64{math.MaxUint64 - 1, 1}, math.MaxUint64, nil},
+		{[]uint64{math.MaxUint64, 1}, 0, errOverflow},
+		{[]uint64{math.MaxUint64 / 2, math.MaxUint64 / 2, 2}, 0, errOverflow},
+	}
+	for _, tc := range tests {
+		leases := make([]activeLease, len(tc.amounts))
+		for i, a := range tc.amounts {
+			leases[i].Amount = a
+		}
+		got, err := totalLeased(leases)
+		if !errors.Is(err, tc.err) || got != tc.want {
+			t.Errorf("totalLeased(%v) = %d, %v; want %d, %v", tc.amounts, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		s     string
+		want  int64
+		valid bool
+	}{
+		{"100000", 100000, true},
+		{"1.5", 150000000, true},
+		{"0.00000001", 1, true},
+		{"92233720368.54775807", math.MaxInt64, true},
+		{"92233720368.54775808", 0, false},
+		{"9223372036854775808", 0, false},
+		{"0.000000001", 0, false},
+		{"-1.5", 0, false},
+		{"1.-5", 0, false},
+		{"abc", 0, false},
+	}
+	for _, tc := range tests {
+		got, err := parseAmount(tc.s)
+		if (err == nil) != tc.valid || (tc.valid && got != tc.want) {
+			t.Errorf("parseAmount('%s') = %d, %v; want %d, valid %t", tc.s, got, err, tc.want, tc.valid)
+		}
+	}
+}
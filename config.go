@@ -0,0 +1,284 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+const defaultNodeURL = "http://localhost:6869"
+
+// Config holds the settings of a run, the command line flags are parsed into it.
+// Empty node URL means the URL of the network preset or the local node. Output, log level and explanations
+// configure the process-wide logger and are applied by main with setupOutput, not by run.
+type Config struct {
+	Network               string
+	NodeURL               string
+	ExplorerURL           string
+	GeneratingSKs         secretList
+	LessorSK              string
+	GeneratingSKFile      string
+	LessorSKFile          string
+	GeneratingSKRef       string
+	LessorSKRef           string
+	GeneratingSeed        string
+	LessorSeed            string
+	GeneratingSeedNonce   uint
+	LessorSeedNonce       uint
+	KeystoreFile          string
+	KeystorePassword      string
+	KeystoreGenerating    string
+	KeystoreLessor        string
+	LessorPK              string
+	LeasingAddress        string
+	ChainID               string
+	Scheme                string
+	ExpectedScheme        string
+	StateFile             string
+	MaxAmountPerDay       amount
+	AbortIfLeasedRecently time.Duration
+	MaxFeeRatio           float64
+	MaxFee                amount
+	FeeMultiplier         float64
+	MinPeers              int
+	MustBeMiner           bool
+	CheckMining           bool
+	TrackInitialDelay     time.Duration
+	ConfirmationTimeout   time.Duration
+	PollInterval          time.Duration
+	MaxPollInterval       time.Duration
+	Confirmations         int
+	RequiredFeature       int
+	ProtobufFeature       int
+	TxVersion             int
+	WaitForFeature        bool
+	MaxClockSkew          time.Duration
+	TimestampOffset       time.Duration
+	MaxBlockAge           time.Duration
+	LeaseNoteExpiry       time.Duration
+	Interval              time.Duration
+	ReportOnlyChanged     bool
+	MetricsAddr           string
+	WebhookURL            string
+	Deadline              time.Duration
+	MaxIterations         int
+	IrreducibleBalance    amount
+	SponsorshipReserve    amount
+	LessorFeeReserve      amount
+	BalanceAlert          amount
+	MinStartBalance       amount
+	LeasingThreshold      amount
+	TransferPercent       int
+	TransferAmount        amount
+	LeaseAmount           amount
+	RoundLease            bool
+	Rounding              string
+	BalanceSource         string
+	TransferAttachment    string
+	FeeAssetID            string
+	LeaseToSelf           bool
+	AllowlistFile         string
+	StrictConfig          bool
+	CoalesceLeases        bool
+	CancelLeaseID         string
+	Unwind                bool
+	WithdrawalAddress     string
+	SkipIfActiveLease     bool
+	ThresholdExitCode     bool
+	BroadcastRetries      int
+	BulkBroadcast         bool
+	APIRetries            int
+	HTTPTimeout           time.Duration
+	ProxyURL              string
+	GRPCAddr              string
+	TLSInsecure           bool
+	TLSCAFile             string
+	HTTPHeaders           headers
+	RawOut                string
+	SignOnly              bool
+	OutputFile            string
+	BroadcastFile         string
+	RawFormat             string
+	DryRun                bool
+	TestRun               bool
+	Output                string
+	LogLevel              string
+	Quiet                 bool
+	Debug                 bool
+	Explain               bool
+	Interactive           bool
+	Probe                 bool
+}
+
+// parseFlags parses the command line arguments into the configuration.
+// It also reports whether the usage information or the version is requested.
+func parseFlags(fs *flag.FlagSet, args []string) (cfg Config, help, showVersion bool, err error) {
+	fs.StringVar(&cfg.Network, "network", "", "Preset of node's URL, chain ID, expected scheme and explorer URL for official network: mainnet, testnet or stagenet")
+	fs.StringVar(&cfg.NodeURL, "node-api", defaultNodeURL, "Node's REST API URL, comma-separated list of URLs to fail over to the next node if the previous is unavailable")
+	fs.StringVar(&cfg.ExplorerURL, "explorer-url", "", "Blockchain explorer URL to log links to transactions")
+	fs.Var(&cfg.GeneratingSKs, "generating-sk", "Base58 encoded private key of generating account, if no key is given it's taken from "+generatingSKEnv+" environment variable, "+
+		"can be repeated to process several generating accounts one after another")
+	fs.StringVar(&cfg.LessorSK, "lessor-sk", "", "Base58 encoded private key of lessor, if no key is given it's taken from "+lessorSKEnv+" environment variable")
+	fs.StringVar(&cfg.GeneratingSKFile, "generating-sk-file", "", "Path to the file with Base58 encoded private key of generating account on the first line")
+	fs.StringVar(&cfg.LessorSKFile, "lessor-sk-file", "", "Path to the file with Base58 encoded private key of lessor on the first line")
+	fs.StringVar(&cfg.GeneratingSKRef, "generating-sk-provider", "", "Secret provider of generating account private key, for example 'exec://command args' to take key from command output or 'file://path' to read it from file")
+	fs.StringVar(&cfg.LessorSKRef, "lessor-sk-provider", "", "Secret provider of lessor private key, for example 'exec://command args' to take key from command output or 'file://path' to read it from file")
+	fs.StringVar(&cfg.GeneratingSeed, "generating-seed", "", "Seed phrase of generating account to derive the private key from")
+	fs.StringVar(&cfg.LessorSeed, "lessor-seed", "", "Seed phrase of lessor to derive the private key from")
+	fs.UintVar(&cfg.GeneratingSeedNonce, "generating-seed-nonce", 0, "Nonce of generating account in the seed, 0 is the first account")
+	fs.UintVar(&cfg.LessorSeedNonce, "lessor-seed-nonce", 0, "Nonce of lessor account in the seed, 0 is the first account")
+	fs.StringVar(&cfg.KeystoreFile, "keystore-file", "", "Path to the encrypted accounts backup file exported from Waves wallet to take private keys from")
+	fs.StringVar(&cfg.KeystorePassword, "keystore-password", "", "Password of the keystore, if no password is given it's taken from "+keystorePasswordEnv+" environment variable")
+	fs.StringVar(&cfg.KeystoreGenerating, "keystore-generating", "", "Address or alias like 'alias:W:name' of generating account to take its private key from the keystore")
+	fs.StringVar(&cfg.KeystoreLessor, "keystore-lessor", "", "Address or alias like 'alias:W:name' of lessor to take its private key from the keystore")
+	fs.StringVar(&cfg.LessorPK, "lessor-pk", "", "Base58 encoded lessor's public key")
+	fs.StringVar(&cfg.LeasingAddress, "leasing-address", "", "Base58 encoded leasing address or alias like 'alias:W:name' if differs from generating account, "+
+		"comma-separated list of addresses with optional weights like 'addr1:60,addr2:40' splits the lease between them")
+	fs.StringVar(&cfg.AllowlistFile, "recipient-allowlist-file", "", "Path to the file with addresses or aliases, one per line, the tool refuses to transfer or lease to any other recipient")
+	fs.BoolVar(&cfg.LeaseToSelf, "lease-to-self", false, "Lease to the generating account itself, this is the default if no leasing address is given")
+	fs.BoolVar(&cfg.StrictConfig, "strict-config", false, "Require explicit configuration of otherwise implicit defaults, for example the leasing recipient")
+	fs.StringVar(&cfg.ChainID, "chain-id", "", "Blockchain scheme (chain ID) to use if it can't be detected from node, for example 'W' for MainNet or 'T' for TestNet")
+	fs.StringVar(&cfg.Scheme, "scheme", "", "Blockchain scheme (chain ID) to use instead of detecting it from node, for example 'W' for MainNet or 'T' for TestNet")
+	fs.StringVar(&cfg.ExpectedScheme, "expected-scheme", "", "Blockchain scheme (chain ID) the node must have, for example 'W' for MainNet, abort if the node is on another network. "+
+		"Values of -scheme, -chain-id and -expected-scheme must not contradict each other")
+	cfg.IrreducibleBalance = waves
+	fs.Var(&cfg.IrreducibleBalance, "irreducible-balance", "Irreducible balance on accounts in WAVELETS, or in WAVES if given with decimal point like 1.5, default value is 1 Waves")
+	fs.Var(&cfg.SponsorshipReserve, "reserve-for-sponsorship", "Additional balance in WAVELETS, or in WAVES if given with decimal point like 1.5 to keep on lessor's account to maintain asset sponsorship")
+	fs.Var(&cfg.LessorFeeReserve, "lessor-fee-reserve", "Additional balance in WAVELETS, or in WAVES if given with decimal point like 1.5 to keep on lessor's account to pay fees of future lease cancels")
+	fs.Var(&cfg.MinStartBalance, "min-start-balance", "Do nothing if generator's available balance is below the given value in WAVELETS, or in WAVES if given with decimal point like 1.5")
+	fs.Var(&cfg.BalanceAlert, "balance-alert-threshold", "Warn if generator's balance after irreducible balance is below the given value in WAVELETS, or in WAVES if given with decimal point like 1.5")
+	fs.StringVar(&cfg.FeeAssetID, "fee-asset", "", "ID of sponsored asset to pay the transfer fee with, lease fee is always paid in WAVES")
+	fs.StringVar(&cfg.TransferAttachment, "transfer-attachment", "", fmt.Sprintf("Text to attach to the transfer transaction, up to %d bytes", maxAttachmentSize))
+	fs.StringVar(&cfg.BalanceSource, "balance-source", balanceAvailable, "Balance to base the transfer and lease on: available, generating or effective, limited by available balance")
+	fs.IntVar(&cfg.TransferPercent, "transfer-percent", 100, "Percent of generator's balance left after irreducible balance to transfer, from 1 to 100")
+	fs.Var(&cfg.LeaseAmount, "lease-amount", "Exact amount in WAVELETS, or in WAVES if given with decimal point like 1.5 to lease instead of the whole lessor's balance, split between leasing addresses by weights")
+	fs.BoolVar(&cfg.RoundLease, "round-lease", false, "Round lease amounts down to whole WAVES, the remainder stays on lessor's account")
+	fs.StringVar(&cfg.Rounding, "rounding", roundingFirst, "Where the remainder of splitting lease amount by weights goes: first, last or largest (by weight) leasing address, or drop to leave it on lessor's account")
+	fs.Var(&cfg.TransferAmount, "transfer-amount", "Exact amount in WAVELETS, or in WAVES if given with decimal point like 1.5 to transfer instead of the whole generator's balance, fee is paid on top of it")
+	fs.Var(&cfg.LeasingThreshold, "leasing-threshold", "Leasing amount threshold in WAVELETS, or in WAVES if given with decimal point like 1.5, a leasing transaction created only if amount is bigger than the given value")
+	fs.StringVar(&cfg.StateFile, "state-file", "", "Path to the file to keep the state between runs")
+	fs.Var(&cfg.MaxAmountPerDay, "max-amount-per-day", "Maximum amount in WAVELETS, or in WAVES if given with decimal point like 1.5 to transfer and, separately, to lease within rolling 24 hours, requires state file")
+	fs.DurationVar(&cfg.AbortIfLeasedRecently, "abort-if-leased-recently", 0, "Abort if lessor has created a lease within the given duration, for example 30m")
+	fs.Float64Var(&cfg.FeeMultiplier, "fee-multiplier", 1, "Multiplier of the fee estimated by node to speed up inclusion of transactions, for example 1.5")
+	fs.Var(&cfg.MaxFee, "max-fee", "Maximum fee of a transaction in WAVELETS, or in WAVES if given with decimal point like 0.01, including extra fee of scripted account, abort if exceeded")
+	fs.Float64Var(&cfg.MaxFeeRatio, "max-fee-ratio", 0, "Maximum ratio of fee to amount, transaction is skipped if the ratio is exceeded, for example 0.01")
+	fs.DurationVar(&cfg.LeaseNoteExpiry, "lease-note-expiry", 0, "Note in the state file that the created lease is intended to be cancelled after the given duration, requires state file")
+	fs.IntVar(&cfg.MinPeers, "min-peers", 0, "Minimal number of peers connected to node to proceed")
+	fs.DurationVar(&cfg.MaxBlockAge, "max-block-age", 0, "Maximum age of the node's last block, for example 3m, abort if the node looks not synchronized")
+	fs.DurationVar(&cfg.TimestampOffset, "timestamp-offset", 0, "Offset added to local time in timestamps of transactions, for example -3s if local clock is ahead of node's clock")
+	fs.DurationVar(&cfg.MaxClockSkew, "max-clock-skew", 0, "Maximum difference between local and node's clocks, for example 5s, abort if exceeded")
+	fs.BoolVar(&cfg.CoalesceLeases, "coalesce-leases", false, "Cancel all active leases of lessor and create one lease of the whole available balance")
+	fs.BoolVar(&cfg.ThresholdExitCode, "threshold-exit-code", false, fmt.Sprintf("Exit with code %d instead of %d if no lease is made because lease amount is below leasing threshold", exitBelowThreshold, exitOK))
+	fs.BoolVar(&cfg.SkipIfActiveLease, "skip-if-active-lease", false, "Do not create a lease if lessor already has an active lease above the leasing threshold to the same recipient")
+	fs.StringVar(&cfg.CancelLeaseID, "cancel-lease", "", "Cancel the active lease of lessor with the given ID and exit")
+	fs.BoolVar(&cfg.Unwind, "unwind", false, "Cancel all active leases of lessor, transfer the freed lessor's balance to withdrawal address and exit")
+	fs.StringVar(&cfg.WithdrawalAddress, "withdrawal-address", "", "Address or alias like 'alias:W:name' to transfer lessor's balance to in unwind mode, generating account if not set")
+	fs.BoolVar(&cfg.SignOnly, "sign-only", false, "Sign transactions and write them to the output file instead of broadcasting")
+	fs.StringVar(&cfg.OutputFile, "output-file", "", "File to write signed transactions as JSON, one per line, in sign-only mode")
+	fs.StringVar(&cfg.BroadcastFile, "broadcast-file", "", "Broadcast and track signed transactions from the file written in sign-only mode and exit, no keys required")
+	fs.StringVar(&cfg.RawOut, "raw-out", "", "Write signed transactions bytes to the file instead of broadcasting, version 2 transactions are in legacy binary format, version 3 in Protobuf")
+	fs.StringVar(&cfg.RawFormat, "raw-format", "hex", "Encoding of transactions written to raw output file: hex, base64 or binary (length-prefixed)")
+	fs.StringVar(&cfg.GRPCAddr, "grpc-addr", "", "Address of node's gRPC API like 127.0.0.1:6870 to use for balances, broadcasting and tracking instead of REST API")
+	fs.StringVar(&cfg.ProxyURL, "proxy", "", "URL of HTTP or SOCKS5 proxy to connect to node through, like socks5://127.0.0.1:1080, overrides HTTP_PROXY and HTTPS_PROXY environment variables")
+	fs.BoolVar(&cfg.TLSInsecure, "tls-insecure", false, "Do not verify TLS certificate of node, use only for testing")
+	fs.StringVar(&cfg.TLSCAFile, "tls-ca-file", "", "Path to PEM file with certificates of CA to trust in addition to system ones when connecting to node")
+	fs.DurationVar(&cfg.HTTPTimeout, "http-timeout", 30*time.Second, "Timeout of a single HTTP request to node, zero means no timeout")
+	fs.Var(&cfg.HTTPHeaders, "header", "Additional HTTP header in form 'Name: Value' to send with every request to node, for example API key, can be repeated")
+	fs.IntVar(&cfg.BroadcastRetries, "broadcast-retries", 3, "Number of broadcast retries on network errors, rate limiting or server errors of node")
+	fs.BoolVar(&cfg.BulkBroadcast, "bulk-broadcast", false, "Broadcast leases to several leasing addresses in one request as JSON array, "+
+		"one by one if node does not accept it")
+	fs.IntVar(&cfg.APIRetries, "api-retries", 2, "Number of retries of balance, script, scheme and activation status requests on network errors, rate limiting or server errors of node")
+	fs.IntVar(&cfg.ProtobufFeature, "protobuf-feature-id", protobufFeatureID, "ID of blockchain feature that enables Protobuf transactions")
+	fs.IntVar(&cfg.TxVersion, "tx-version", 0, "Version of transactions to produce, 2 or 3, detected from Protobuf activation status if not set")
+	fs.IntVar(&cfg.RequiredFeature, "require-feature", 0, "ID of blockchain feature that must be activated to proceed")
+	fs.BoolVar(&cfg.WaitForFeature, "wait-for-feature", false, "Wait for activation of required feature instead of aborting")
+	fs.DurationVar(&cfg.TrackInitialDelay, "track-initial-delay", 0, "Delay before the first check of broadcasted transaction")
+	fs.BoolVar(&cfg.MustBeMiner, "generator-must-be-miner", false, "Abort if generating account neither produced recent blocks nor has enough generating balance to mine")
+	fs.BoolVar(&cfg.CheckMining, "check-recipient-mining", false, "Warn if leasing address produced none of recent blocks, so the lease may go to a node that does not mine")
+	fs.DurationVar(&cfg.ConfirmationTimeout, "confirmation-timeout", 2*time.Minute, "Maximum time to wait for transaction to appear on blockchain")
+	fs.IntVar(&cfg.Confirmations, "confirmations", 1, "Number of blocks, including the block with transaction, to wait for before transaction is considered confirmed")
+	fs.DurationVar(&cfg.PollInterval, "poll-interval", time.Second, "Interval between checks of broadcasted transaction")
+	fs.DurationVar(&cfg.MaxPollInterval, "max-poll-interval", 10*time.Second, "Maximum interval between checks of transaction already in block while waiting for confirmations, "+
+		"the interval doubles starting from poll interval, zero disables the growth")
+	fs.DurationVar(&cfg.Deadline, "deadline", 0, "Maximal duration of the whole operation, the tool aborts with failure if it does not finish in time")
+	fs.StringVar(&cfg.WebhookURL, "webhook-url", "", "URL to post JSON notifications about results of runs and low balance alerts to")
+	fs.StringVar(&cfg.MetricsAddr, "metrics-addr", "", "Address to serve Prometheus metrics on, for example 127.0.0.1:9090, metrics are not served if not set")
+	fs.DurationVar(&cfg.Interval, "interval", 0, "Interval between repeated runs, for example 24h, the tool runs once if not set")
+	fs.BoolVar(&cfg.ReportOnlyChanged, "report-only-changed", false, "With -interval, drop the log of a run that made no transactions and ended like the previous one, "+
+		"warnings and errors are always logged and a heartbeat line is logged hourly")
+	fs.IntVar(&cfg.MaxIterations, "max-iterations", 0, "Maximum number of repeated runs, unlimited if not set")
+	fs.BoolVar(&cfg.DryRun, "dry-run", false, "Test execution without creating real transactions on blockchain")
+	fs.BoolVar(&cfg.TestRun, "test-run", false, "Test execution with limited available balance of 1 WAVES")
+	fs.StringVar(&cfg.LogLevel, "log-level", "", "Minimal level of log messages: debug, info, warn or error, info if not set, debug level also logs requests to node and raw responses")
+	fs.StringVar(&cfg.Output, "output", outputText, "Output format: text or json for one JSON object per line")
+	fs.BoolVar(&cfg.Probe, "probe", false, "Only check that node is reachable, and synchronized if -max-block-age is set, and exit, useful as container health check")
+	fs.BoolVar(&cfg.Explain, "explain", false, "Explain the arithmetic behind every decision")
+	fs.BoolVar(&cfg.Interactive, "interactive", false, "Ask for confirmation before broadcasting each transaction, ignored if standard input is not a terminal")
+	fs.BoolVar(&cfg.Quiet, "quiet", false, "Log only errors, same as -log-level error")
+	fs.BoolVar(&cfg.Debug, "debug", false, "Log additional debug information, same as -log-level debug")
+	fs.BoolVar(&help, "help", false, "Show usage information and exit")
+	fs.BoolVar(&showVersion, "version", false, "Print version information and quit")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, false, false, err
+	}
+	if cfg.Network != "" { // Node URL of the network preset is used unless the URL is given explicitly
+		set := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if !set["node-api"] {
+			cfg.NodeURL = ""
+		}
+	}
+	return cfg, help, showVersion, nil
+}
+
+// logLevel resolves the minimal log level from -log-level and its aliases -debug and -quiet.
+func (cfg Config) logLevel() (string, error) {
+	level := cfg.LogLevel
+	aliases := []struct {
+		set         bool
+		flag, level string
+	}{
+		{cfg.Debug, "debug", "debug"},
+		{cfg.Quiet, "quiet", "error"},
+	}
+	for _, a := range aliases {
+		if !a.set {
+			continue
+		}
+		if level != "" && level != a.level {
+			return "", fmt.Errorf("option -%s conflicts with log level '%s'", a.flag, level)
+		}
+		level = a.level
+	}
+	if level == "" {
+		return "info", nil
+	}
+	return level, nil
+}
+
+// scheme returns the blockchain scheme given with -scheme, -chain-id or -expected-scheme, or zero if none is given.
+// The options differ in how the scheme of node is treated: used without detection, used if detection fails or
+// checked against the detected one. So the values given to several of them must be the same.
+func (cfg Config) scheme() (byte, error) {
+	var (
+		s    byte
+		flag string
+	)
+	for _, o := range []struct{ flag, value string }{
+		{"scheme", cfg.Scheme},
+		{"chain-id", cfg.ChainID},
+		{"expected-scheme", cfg.ExpectedScheme},
+	} {
+		if o.value == "" {
+			continue
+		}
+		if len(o.value) != 1 || !isPlausibleScheme(o.value[0]) {
+			return 0, fmt.Errorf("invalid value '%s' of option -%s", o.value, o.flag)
+		}
+		if s != 0 && o.value[0] != s {
+			return 0, fmt.Errorf("option -%s '%s' contradicts -%s '%s'", o.flag, o.value, flag, string(s))
+		}
+		s, flag = o.value[0], o.flag
+	}
+	return s, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestConfigScheme(t *testing.T) {
+	tests := []struct {
+		name                     string
+		scheme, chainID, expects string
+		want                     byte
+		ok                       bool
+	}{
+		{"none", "", "", "", 0, true},
+		{"scheme", "T", "", "", 'T', true},
+		{"chain ID", "", "S", "", 'S', true},
+		{"expected scheme", "", "", "W", 'W', true},
+		{"all the same", "W", "W", "W", 'W', true},
+		{"chain ID and expected scheme", "", "T", "T", 'T', true},
+		{"scheme contradicts expected", "T", "", "W", 0, false},
+		{"scheme contradicts chain ID", "W", "T", "", 0, false},
+		{"chain ID contradicts expected", "", "T", "W", 0, false},
+		{"invalid scheme", "WW", "", "", 0, false},
+		{"invalid chain ID", "", "\x01", "", 0, false},
+		{"invalid expected scheme", "", "", " ", 0, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := Config{Scheme: tc.scheme, ChainID: tc.chainID, ExpectedScheme: tc.expects}
+			s, err := cfg.scheme()
+			if tc.ok != (err == nil) {
+				t.Fatalf("scheme() error = %v, want error %t", err, !tc.ok)
+			}
+			if s != tc.want {
+				t.Errorf("scheme() = %q, want %q", s, tc.want)
+			}
+		})
+	}
+}
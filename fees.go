@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/bits"
+	"net/http"
+
+	"github.com/wavesplatform/gowaves/pkg/crypto"
+	"github.com/wavesplatform/gowaves/pkg/proto"
+)
+
+// sponsoredFeeUnit is the fee in WAVELETS that costs the minimal sponsored fee of an asset.
+const sponsoredFeeUnit = 100000
+
+type feeResponse struct {
+	FeeAssetID *string `json:"feeAssetId"`
+	FeeAmount  uint64  `json:"feeAmount"`
+}
+
+// estimateFee asks node to calculate the fee of unsigned transaction.
+// The node's estimate already includes the extra fee for scripted accounts and assets.
+func estimateFee(ctx context.Context, cl *node, tx proto.Transaction) (uint64, error) {
+	b, err := json.Marshal(tx)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest("POST", cl.GetOptions().BaseUrl+"/transactions/calculateFee", bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+	resp := new(feeResponse)
+	if _, err := cl.Do(ctx, req, resp); err != nil {
+		return 0, err
+	}
+	if resp.FeeAmount == 0 {
+		return 0, errors.New("zero fee estimate")
+	}
+	return resp.FeeAmount, nil
+}
+
+// multiplyFee multiplies the fee by the multiplier rounding up.
+func multiplyFee(fee uint64, multiplier float64) (uint64, error) {
+	f := math.Ceil(float64(fee) * multiplier)
+	if f >= math.MaxInt64 {
+		return 0, fmt.Errorf("%w: %d * %g", errOverflow, fee, multiplier)
+	}
+	return uint64(f), nil
+}
+
+// fee returns the node's estimate of transaction fee or the given fallback fee if node can't estimate it,
+// padded with the fee multiplier. The kind of transaction is used for logging.
+func (c *cycle) fee(ctx context.Context, tx proto.Transaction, fallback uint64, kind string) (uint64, error) {
+	fee, err := estimateFee(ctx, c.cl, tx)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return 0, err
+		}
+		log.Printf("[WARN] Failed to estimate %s fee, using %s: %v", kind, format(fallback), err)
+		fee = fallback
+	} else {
+		explainf("Node estimates %s fee as %s", kind, format(fee))
+	}
+	if c.feeMultiplier != 1 {
+		f, err := multiplyFee(fee, c.feeMultiplier)
+		if err != nil {
+			return 0, err
+		}
+		explainf("The %s fee %s multiplied by %g is %s", kind, format(fee), c.feeMultiplier, format(f))
+		fee = f
+	}
+	if c.maxFee > 0 && fee > uint64(c.maxFee) {
+		return 0, fmt.Errorf("%s fee %s exceeds maximum fee %s", kind, format(fee), format(uint64(c.maxFee)))
+	}
+	return fee, nil
+}
+
+// sponsoredFee converts the fee in WAVELETS to the fee in sponsored asset rounding up.
+func sponsoredFee(ctx context.Context, cl *node, asset crypto.Digest, fee uint64) (uint64, error) {
+	d, _, err := cl.Assets.Details(ctx, asset)
+	if err != nil {
+		return 0, err
+	}
+	if d.MinSponsoredAssetFee == 0 {
+		return 0, fmt.Errorf("asset '%s' is not sponsored", asset.String())
+	}
+	hi, lo := bits.Mul64(fee, d.MinSponsoredAssetFee)
+	lo, carry := bits.Add64(lo, sponsoredFeeUnit-1, 0)
+	hi += carry
+	if hi >= sponsoredFeeUnit {
+		return 0, fmt.Errorf("%w: fee %d in asset '%s'", errOverflow, fee, asset.String())
+	}
+	r, _ := bits.Div64(hi, lo, sponsoredFeeUnit)
+	explainf("Fee %s is %d in units of sponsored asset '%s' with minimal fee %d", format(fee), r, asset.String(), d.MinSponsoredAssetFee)
+	return r, nil
+}
+
+// assetFee returns the transfer fee in the fee asset and checks that generator has enough of the asset to pay it.
+func (c *cycle) assetFee(ctx context.Context, fee uint64) (uint64, error) {
+	f, err := sponsoredFee(ctx, c.cl, c.feeAsset.ID, fee)
+	if err != nil {
+		return 0, err
+	}
+	b, _, err := c.cl.Assets.BalanceByAddressAndAsset(ctx, c.gAddr, c.feeAsset.ID)
+	if err != nil {
+		return 0, err
+	}
+	if b.Balance < f {
+		return 0, fmt.Errorf("balance %d of asset '%s' is less than fee %d", b.Balance, c.feeAsset.ID.String(), f)
+	}
+	log.Printf("[INFO] Transfer fee is %d of asset '%s', generator has %d", f, c.feeAsset.ID.String(), b.Balance)
+	return f, nil
+}
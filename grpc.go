@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/wavesplatform/gowaves/pkg/client"
+	"github.com/wavesplatform/gowaves/pkg/crypto"
+	g "github.com/wavesplatform/gowaves/pkg/grpc/generated/waves/node/grpc"
+	"github.com/wavesplatform/gowaves/pkg/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// node is the client of node's API. If gRPC API is set, it's used instead of REST API for balances, active leases,
+// broadcasting, tracking and detection of scheme and features. Other requests always go to REST API.
+type node struct {
+	*client.Client
+	grpc    *grpcNode
+	retries int  // Retries of queries on network errors, rate limiting or server errors
+	confirm bool // Ask user for confirmation before broadcasting
+}
+
+type grpcNode struct {
+	conn         *grpc.ClientConn
+	scheme       proto.Scheme
+	accounts     g.AccountsApiClient
+	transactions g.TransactionsApiClient
+	blockchain   g.BlockchainApiClient
+	blocks       g.BlocksApiClient
+}
+
+// dialGRPC connects to node's gRPC API. The connection is made over TLS only if TLS configuration is given.
+func dialGRPC(addr string, tc *tls.Config) (*grpcNode, error) {
+	creds := insecure.NewCredentials()
+	if tc != nil {
+		creds = credentials.NewTLS(tc)
+	}
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	return &grpcNode{
+		conn:         conn,
+		accounts:     g.NewAccountsApiClient(conn),
+		transactions: g.NewTransactionsApiClient(conn),
+		blockchain:   g.NewBlockchainApiClient(conn),
+		blocks:       g.NewBlocksApiClient(conn),
+	}, nil
+}
+
+func (n *grpcNode) close() error {
+	return n.conn.Close()
+}
+
+func (n *grpcNode) balanceDetails(ctx context.Context, addr proto.WavesAddress) (*client.AddressesBalanceDetails, error) {
+	stream, err := n.accounts.GetBalances(ctx, &g.BalancesRequest{Address: addr.Bytes(), Assets: [][]byte{{}}})
+	if err != nil {
+		return nil, err
+	}
+	for {
+		b, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("no WAVES balance in response")
+			}
+			return nil, err
+		}
+		if w := b.GetWaves(); w != nil {
+			return &client.AddressesBalanceDetails{
+				Address:    addr,
+				Regular:    uint64(w.Regular),
+				Generating: uint64(w.Generating),
+				Available:  uint64(w.Available),
+				Effective:  uint64(w.Effective),
+			}, nil
+		}
+	}
+}
+
+func (n *grpcNode) activeLeases(ctx context.Context, addr proto.WavesAddress) ([]activeLease, error) {
+	stream, err := n.accounts.GetActiveLeases(ctx, &g.AccountRequest{Address: addr.Bytes()})
+	if err != nil {
+		return nil, err
+	}
+	var c proto.ProtobufConverter
+	var r []activeLease
+	for {
+		l, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return r, nil
+			}
+			return nil, err
+		}
+		id, err := crypto.NewDigestFromBytes(l.LeaseId)
+		if err != nil {
+			return nil, err
+		}
+		origin, err := crypto.NewDigestFromBytes(l.OriginTransactionId)
+		if err != nil {
+			return nil, err
+		}
+		sender, err := c.Address(byte(n.scheme), l.Sender)
+		if err != nil {
+			return nil, err
+		}
+		rcp, err := c.Recipient(byte(n.scheme), l.Recipient)
+		if err != nil {
+			return nil, err
+		}
+		if l.Amount < 0 || l.Height < 0 {
+			return nil, errors.New("negative lease amount or height")
+		}
+		r = append(r, activeLease{
+			ID:                  id,
+			OriginTransactionID: &origin,
+			Sender:              sender,
+			Recipient:           rcp,
+			Amount:              uint64(l.Amount),
+			Height:              uint64(l.Height),
+		})
+	}
+}
+
+func (n *grpcNode) broadcast(ctx context.Context, tx proto.Transaction) error {
+	st, err := tx.ToProtobufSigned(n.scheme)
+	if err != nil {
+		return err
+	}
+	_, err = n.transactions.Broadcast(ctx, st)
+	return err
+}
+
+func (n *grpcNode) transactionStatus(ctx context.Context, id crypto.Digest) (*transactionStatus, error) {
+	stream, err := n.transactions.GetStatuses(ctx, &g.TransactionsByIdRequest{TransactionIds: [][]byte{id.Bytes()}})
+	if err != nil {
+		return nil, err
+	}
+	s, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if s.Status != g.TransactionStatus_CONFIRMED {
+		return nil, errNotFound
+	}
+	st := &transactionStatus{ID: id, Height: uint64(s.Height)}
+	if s.ApplicationStatus != g.ApplicationStatus_UNKNOWN {
+		st.ApplicationStatus = strings.ToLower(s.ApplicationStatus.String())
+	}
+	return st, nil
+}
+
+// known checks that transaction is on blockchain or in node's UTX pool.
+func (n *grpcNode) known(ctx context.Context, id crypto.Digest) (bool, error) {
+	stream, err := n.transactions.GetStatuses(ctx, &g.TransactionsByIdRequest{TransactionIds: [][]byte{id.Bytes()}})
+	if err != nil {
+		return false, err
+	}
+	s, err := stream.Recv()
+	if err != nil {
+		return false, err
+	}
+	return s.Status == g.TransactionStatus_CONFIRMED || s.Status == g.TransactionStatus_UNCONFIRMED, nil
+}
+
+func (n *grpcNode) height(ctx context.Context) (uint64, error) {
+	h, err := n.blocks.GetCurrentHeight(ctx, &emptypb.Empty{})
+	if err != nil {
+		return 0, err
+	}
+	return uint64(h.GetValue()), nil
+}
+
+// chainID returns the scheme from the header of the last block.
+func (n *grpcNode) chainID(ctx context.Context) (proto.Scheme, error) {
+	h, err := n.height(ctx)
+	if err != nil {
+		return 0, err
+	}
+	b, err := n.blocks.GetBlock(ctx, &g.BlockRequest{Request: &g.BlockRequest_Height{Height: int32(h)}})
+	if err != nil {
+		return 0, err
+	}
+	return proto.Scheme(b.GetBlock().GetHeader().GetChainId()), nil
+}
+
+func (n *grpcNode) activationStatus(ctx context.Context) (*activationStatusResponse, error) {
+	h, err := n.height(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s, err := n.blockchain.GetActivationStatus(ctx, &g.ActivationStatusRequest{Height: int32(h)})
+	if err != nil {
+		return nil, err
+	}
+	r := &activationStatusResponse{
+		Height:          int(s.Height),
+		VotingInterval:  int(s.VotingInterval),
+		VotingThreshold: int(s.VotingThreshold),
+		NextCheck:       int(s.NextCheck),
+	}
+	for _, f := range s.Features {
+		r.Features = append(r.Features, feature{
+			ID:               int(f.Id),
+			Description:      f.Description,
+			BlockchainStatus: f.BlockchainStatus.String(),
+			NodeStatus:       f.NodeStatus.String(),
+			ActivationHeight: int(f.ActivationHeight),
+		})
+	}
+	return r, nil
+}
+
+// isGRPCError reports whether the error is returned by gRPC call.
+func isGRPCError(err error) bool {
+	_, ok := status.FromError(err)
+	return ok && err != nil
+}
+
+// isTransientGRPC reports whether the gRPC call failed because node is unavailable.
+func isTransientGRPC(err error) bool {
+	s, ok := status.FromError(err)
+	return ok && err != nil && s.Code() == codes.Unavailable
+}
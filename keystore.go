@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/wavesplatform/gowaves/pkg/crypto"
+	"github.com/wavesplatform/gowaves/pkg/proto"
+)
+
+const (
+	keystorePasswordEnv     = "WAVES_KEYSTORE_PASSWORD"
+	defaultEncryptionRounds = 5000
+	opensslSaltedPrefix     = "Salted__"
+	opensslSaltSize         = 8
+	keystoreAccountTypeSeed = "seed"
+	keystoreAccountTypeKey  = "privateKey"
+)
+
+var errWrongPassword = errors.New("wrong password or corrupted keystore")
+
+// keystoreFile is the encrypted accounts backup exported by Waves wallets.
+// The list of accounts is serialized to JSON and encrypted with AES-256-CBC in OpenSSL compatible format,
+// the passphrase is the password strengthened by the given number of rounds of hex encoded SHA-256.
+type keystoreFile struct {
+	Encrypted        string `json:"encrypted"`
+	EncryptionRounds int    `json:"encryptionRounds"`
+}
+
+type keystoreAccount struct {
+	Name       string `json:"name"`
+	Type       string `json:"userType"`
+	Seed       string `json:"seed"`
+	PrivateKey string `json:"privateKey"`
+}
+
+// keystoreProvider takes the private key of the account with the given address from the keystore.
+// The keystore is decrypted on every fetch and the decrypted data is not kept.
+type keystoreProvider struct {
+	path     string
+	password string
+	account  string
+	addr     proto.WavesAddress
+}
+
+func newKeystoreProvider(path, password, account string) (*keystoreProvider, error) {
+	if password == "" {
+		return nil, fmt.Errorf("no keystore password is given with flag or %s environment variable", keystorePasswordEnv)
+	}
+	if _, err := parseRecipient(account); err != nil {
+		return nil, fmt.Errorf("invalid keystore account '%s': %w", account, err)
+	}
+	return &keystoreProvider{path: path, password: password, account: account}, nil
+}
+
+// resolve finds out the address of the account, resolving alias on node if necessary.
+func (p *keystoreProvider) resolve(ctx context.Context, cl *node) error {
+	rcp, err := parseRecipient(p.account)
+	if err != nil {
+		return err
+	}
+	if rcp.Alias == nil {
+		p.addr = *rcp.Address
+		return nil
+	}
+	addr, _, err := cl.Alias.Get(ctx, rcp.Alias.Alias)
+	if err != nil {
+		return fmt.Errorf("failed to resolve alias '%s': %w", p.account, err)
+	}
+	p.addr = addr
+	return nil
+}
+
+func (p *keystoreProvider) fetch(ctx context.Context) ([]byte, error) {
+	b, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, err
+	}
+	kf := new(keystoreFile)
+	if err := json.Unmarshal(b, kf); err != nil {
+		return nil, fmt.Errorf("invalid keystore: %w", err)
+	}
+	data, err := decryptKeystore(kf, p.password)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(data)
+	var accounts []keystoreAccount
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("invalid keystore accounts: %w", err)
+	}
+	for _, a := range accounts {
+		sk, err := a.secretKey(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("invalid keystore account '%s': %w", a.Name, err)
+		}
+		addr, err := proto.NewAddressFromPublicKey(p.addr.Bytes()[1], crypto.GeneratePublicKey(sk))
+		if err != nil {
+			return nil, err
+		}
+		if addr == p.addr {
+			return []byte(sk.String()), nil
+		}
+		zero(sk[:])
+	}
+	return nil, fmt.Errorf("no account with address '%s' in keystore", p.addr.String())
+}
+
+func (a *keystoreAccount) secretKey(ctx context.Context) (crypto.SecretKey, error) {
+	switch {
+	case a.Type == keystoreAccountTypeKey || a.Type == "" && a.PrivateKey != "":
+		return crypto.NewSecretKeyFromBase58(a.PrivateKey)
+	case a.Type == keystoreAccountTypeSeed || a.Type == "" && a.Seed != "":
+		return fetchSK(ctx, &seedProvider{seed: a.Seed})
+	default:
+		return crypto.SecretKey{}, fmt.Errorf("unsupported account type '%s'", a.Type)
+	}
+}
+
+func decryptKeystore(kf *keystoreFile, password string) ([]byte, error) {
+	rounds := kf.EncryptionRounds
+	if rounds == 0 {
+		rounds = defaultEncryptionRounds
+	}
+	b, err := base64.StdEncoding.DecodeString(kf.Encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keystore: %w", err)
+	}
+	if len(b) < len(opensslSaltedPrefix)+opensslSaltSize || !bytes.HasPrefix(b, []byte(opensslSaltedPrefix)) {
+		return nil, errors.New("invalid keystore: unsupported encryption format")
+	}
+	salt := b[len(opensslSaltedPrefix) : len(opensslSaltedPrefix)+opensslSaltSize]
+	ct := b[len(opensslSaltedPrefix)+opensslSaltSize:]
+	if len(ct) == 0 || len(ct)%aes.BlockSize != 0 {
+		return nil, errWrongPassword
+	}
+	pass := []byte(password)
+	for i := 0; i < rounds; i++ {
+		h := sha256.Sum256(pass)
+		zero(pass)
+		pass = []byte(hex.EncodeToString(h[:]))
+	}
+	defer zero(pass)
+	key, iv := bytesToKey(pass, salt)
+	defer zero(key)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, len(ct))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, ct)
+	n := int(data[len(data)-1])
+	if n == 0 || n > aes.BlockSize {
+		zero(data)
+		return nil, errWrongPassword
+	}
+	for _, v := range data[len(data)-n:] {
+		if int(v) != n {
+			zero(data)
+			return nil, errWrongPassword
+		}
+	}
+	return data[:len(data)-n], nil
+}
+
+// bytesToKey derives AES-256 key and IV from the passphrase the same way as OpenSSL's EVP_BytesToKey with MD5 does.
+func bytesToKey(pass, salt []byte) ([]byte, []byte) {
+	var r, prev []byte
+	for len(r) < 32+aes.BlockSize {
+		h := md5.New()
+		h.Write(prev)
+		h.Write(pass)
+		h.Write(salt)
+		prev = h.Sum(nil)
+		r = append(r, prev...)
+	}
+	return r[:32], r[32 : 32+aes.BlockSize]
+}
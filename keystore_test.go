@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wavesplatform/gowaves/pkg/crypto"
+	"github.com/wavesplatform/gowaves/pkg/proto"
+)
+
+// Known answers below are produced with OpenSSL, for example:
+//
+//	printf '%s' "$ACCOUNTS" | openssl enc -aes-256-cbc -md md5 -S a1b2c3d4e5f60708 -pass pass:$(printf secret | sha256sum | cut -d' ' -f1)
+//
+// with "Salted__" and the salt prepended, as OpenSSL does when the salt is random.
+const (
+	testKeystoreKey      = "3vPq1nGu9yGXwMqDhGwovXakL27RAMwLQQrmi3qPQKdM"
+	testKeystoreAccounts = `[{"name":"gen","userType":"privateKey","privateKey":"` + testKeystoreKey + `"}]`
+	// Encrypted with 1 round of password hashing.
+	testKeystoreOneRound = "U2FsdGVkX1+hssPU5fYHCCfR+H/8R9AmwLs6CM3MLXsIl/2IiPLNOykbyTTkWYGXDlDWlTAOqmvl6vn/mZYEDMP5KMwegMm9Vmoe32FLUToase5RPnNrXI3yVJY/90vTQojVLPvn26Ibb39MH7/k7aujoOn38EdLDCOyiOBvddY="
+	// Encrypted with the default 5000 rounds of password hashing.
+	testKeystoreDefaultRounds = "U2FsdGVkX18IBwYFBAMCAaCPEKOppm/j+NJBrqQoC69O674gDAk7xX5MKEqkpx9KH41bWZtRxVxpg8Unw0ezp5vZuqmfGZPdc210YQS/1PpRRR1BnRcKJ70rh02XYRYNKVboFCyJdrCjZpWGWBTcpSf6q+KWZWFSVmkAG37+eDc="
+	// Single block "0123456789abcde\x00" encrypted with -nopad, so the padding is invalid.
+	testKeystoreBadPadding = "U2FsdGVkX1+hssPU5fYHCBgcziDKRM6WirWA//jgc+c="
+)
+
+func TestBytesToKey(t *testing.T) {
+	// openssl enc -aes-256-cbc -md md5 -S 0102030405060708 -pass pass:password -P
+	salt, _ := hex.DecodeString("0102030405060708")
+	key, iv := bytesToKey([]byte("password"), salt)
+	if k := hex.EncodeToString(key); k != "e7b0971e52ca5cc8d0539fb3412f6316f7ba2e6ee293d9f3457b99436b51ce02" {
+		t.Errorf("unexpected key %s", k)
+	}
+	if v := hex.EncodeToString(iv); v != "8d450e2ed75a84a923d4eac9fe49226b" {
+		t.Errorf("unexpected iv %s", v)
+	}
+}
+
+func TestDecryptKeystore(t *testing.T) {
+	tests := []struct {
+		name      string
+		encrypted string
+		rounds    int
+		password  string
+		err       error
+	}{
+		{"one round", testKeystoreOneRound, 1, "secret", nil},
+		{"default rounds", testKeystoreDefaultRounds, 0, "secret", nil},
+		{"explicit default rounds", testKeystoreDefaultRounds, defaultEncryptionRounds, "secret", nil},
+		{"wrong password", testKeystoreOneRound, 1, "Secret", errWrongPassword},
+		{"wrong rounds", testKeystoreOneRound, 2, "secret", errWrongPassword},
+		{"bad padding", testKeystoreBadPadding, 1, "secret", errWrongPassword},
+		{"truncated", testKeystoreOneRound[:len(testKeystoreOneRound)-24] + "AAAA", 1, "secret", errWrongPassword},
+		{"no ciphertext", "U2FsdGVkX1+hssPU5fYHCA==", 1, "secret", errWrongPassword},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := decryptKeystore(&keystoreFile{Encrypted: tc.encrypted, EncryptionRounds: tc.rounds}, tc.password)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if tc.err == nil && string(data) != testKeystoreAccounts {
+				t.Errorf("unexpected data %q", data)
+			}
+		})
+	}
+}
+
+func TestDecryptKeystoreInvalidFormat(t *testing.T) {
+	for _, s := range []string{"not base64!", "", "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=", "U2FsdGVkX18="} {
+		_, err := decryptKeystore(&keystoreFile{Encrypted: s, EncryptionRounds: 1}, "secret")
+		if err == nil || errors.Is(err, errWrongPassword) {
+			t.Errorf("%q: expected format error, got %v", s, err)
+		}
+	}
+}
+
+func TestKeystoreProviderFetch(t *testing.T) {
+	sk, err := crypto.NewSecretKeyFromBase58(testKeystoreKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := proto.NewAddressFromPublicKey(proto.MainNetScheme, crypto.GeneratePublicKey(sk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := newTestAccount(t, "other")
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	if err := os.WriteFile(path, []byte(`{"encrypted":"`+testKeystoreOneRound+`","encryptionRounds":1}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := newKeystoreProvider(path, "secret", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.resolve(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err := p.fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != testKeystoreKey {
+		t.Errorf("unexpected key %s", b)
+	}
+
+	p, err = newKeystoreProvider(path, "secret", other.addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.resolve(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.fetch(context.Background()); err == nil {
+		t.Error("expected error for account missing in keystore")
+	}
+
+	p.password = "wrong"
+	if _, err := p.fetch(context.Background()); !errors.Is(err, errWrongPassword) {
+		t.Errorf("expected wrong password error, got %v", err)
+	}
+}
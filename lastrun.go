@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+func (s *summary) record() runRecord {
+	r := runRecord{Generator: s.generator.String(), Timestamp: timestamp(), Transfer: s.transferAmount}
+	for _, l := range s.leases {
+		found := false
+		for i := range r.Leases {
+			if r.Leases[i].Recipient == l.Recipient {
+				r.Leases[i].Amount += l.Amount
+				found = true
+				break
+			}
+		}
+		if !found {
+			r.Leases = append(r.Leases, leaseRecord{Recipient: l.Recipient, Amount: l.Amount})
+		}
+	}
+	return r
+}
+
+// recordRun keeps the outcome of the run in the state file to compare the next dry-run with.
+func (c *cycle) recordRun() {
+	c.st.setLastRun(c.sum.record())
+	if err := c.saveState(); err != nil {
+		log.Printf("[WARN] Failed to save state to file '%s': %v", c.stateFile, err)
+	}
+}
+
+// diffLastRun reports how the planned transfer and leases differ from the last recorded run of the generator.
+func (c *cycle) diffLastRun() {
+	prev := c.st.lastRun(c.gAddr.String())
+	if prev == nil {
+		log.Printf("[INFO] DRY-RUN: No previous run of '%s' in state file to compare with", c.gAddr.String())
+		return
+	}
+	diffs := diffRuns(*prev, c.sum.record())
+	at := time.UnixMilli(int64(prev.Timestamp)).Format(time.RFC3339)
+	if len(diffs) == 0 {
+		log.Printf("[INFO] DRY-RUN: No differences from the previous run at %s", at)
+		return
+	}
+	log.Printf("[INFO] DRY-RUN: Differences from the previous run at %s:", at)
+	for _, d := range diffs {
+		log.Printf("[INFO]   %s", d)
+	}
+}
+
+func diffRuns(prev, next runRecord) []string {
+	var r []string
+	if d := change(prev.Transfer, next.Transfer); d != "" {
+		r = append(r, "transfer amount "+d)
+	}
+	if len(prev.Leases) == 1 && len(next.Leases) == 1 && prev.Leases[0].Recipient != next.Leases[0].Recipient {
+		r = append(r, fmt.Sprintf("recipient changed from '%s' to '%s'", prev.Leases[0].Recipient, next.Leases[0].Recipient))
+		if d := change(prev.Leases[0].Amount, next.Leases[0].Amount); d != "" {
+			r = append(r, "lease amount "+d)
+		}
+		return r
+	}
+	for _, n := range next.Leases {
+		p := findLeaseRecord(prev.Leases, n.Recipient)
+		switch {
+		case p == nil:
+			r = append(r, fmt.Sprintf("recipient '%s' added with %s", n.Recipient, format(n.Amount)))
+		case change(p.Amount, n.Amount) != "":
+			r = append(r, fmt.Sprintf("lease to '%s' %s", n.Recipient, change(p.Amount, n.Amount)))
+		}
+	}
+	for _, p := range prev.Leases {
+		if findLeaseRecord(next.Leases, p.Recipient) == nil {
+			r = append(r, fmt.Sprintf("recipient '%s' removed, leased %s before", p.Recipient, format(p.Amount)))
+		}
+	}
+	return r
+}
+
+func findLeaseRecord(leases []leaseRecord, recipient string) *leaseRecord {
+	for i := range leases {
+		if leases[i].Recipient == recipient {
+			return &leases[i]
+		}
+	}
+	return nil
+}
+
+// change describes the change of amount, empty string is returned if the amount is the same.
+func change(before, after uint64) string {
+	switch {
+	case after > before:
+		return fmt.Sprintf("up %s, from %s to %s", format(after-before), format(before), format(after))
+	case after < before:
+		return fmt.Sprintf("down %s, from %s to %s", format(before-after), format(before), format(after))
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/bits"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wavesplatform/gowaves/pkg/client"
+	"github.com/wavesplatform/gowaves/pkg/crypto"
+	"github.com/wavesplatform/gowaves/pkg/proto"
+)
+
+// activeLease covers both the lease details returned by modern nodes and the lease transactions returned by legacy ones.
+type activeLease struct {
+	ID                  crypto.Digest      `json:"id"`
+	OriginTransactionID *crypto.Digest     `json:"originTransactionId,omitempty"`
+	Sender              proto.WavesAddress `json:"sender"`
+	Recipient           proto.Recipient    `json:"recipient"`
+	Amount              uint64             `json:"amount"`
+	Height              uint64             `json:"height"`
+	Timestamp           uint64             `json:"timestamp,omitempty"`
+}
+
+func (l activeLease) originID() crypto.Digest {
+	if l.OriginTransactionID != nil {
+		return *l.OriginTransactionID
+	}
+	return l.ID
+}
+
+func getActiveLeases(ctx context.Context, cl *node, addr proto.WavesAddress) ([]activeLease, error) {
+	var leases []activeLease
+	err := retry(ctx, cl.retries, "get active leases", func() (*client.Response, error) {
+		var err error
+		if cl.grpc != nil {
+			leases, err = cl.grpc.activeLeases(ctx, addr)
+			return nil, err
+		}
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/leasing/active/%s", cl.GetOptions().BaseUrl, addr.String()), nil)
+		if err != nil {
+			return nil, err
+		}
+		leases = nil
+		return cl.Do(ctx, req, &leases)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r := make([]activeLease, 0, len(leases))
+	for _, l := range leases {
+		if l.Sender == addr {
+			r = append(r, l)
+		}
+	}
+	sort.SliceStable(r, func(i, j int) bool { return r[i].Height > r[j].Height })
+	return r, nil
+}
+
+func listActiveLeases(ctx context.Context, cl *node, addr proto.WavesAddress) ([]activeLease, error) {
+	leases, err := getActiveLeases(ctx, cl, addr)
+	if err != nil {
+		return nil, err
+	}
+	total, err := totalLeased(leases)
+	if err != nil {
+		return nil, fmt.Errorf("invalid total of active leases: %w", err)
+	}
+	log.Printf("[INFO] Active leases of '%s': %d of total %s", addr.String(), len(leases), format(total))
+	for _, l := range leases {
+		log.Printf("[INFO] Active lease '%s' of %s to '%s'", l.ID.String(), format(l.Amount), l.Recipient.String())
+	}
+	return leases, nil
+}
+
+// findActiveLease returns the active lease to the recipient bigger than the given amount.
+func findActiveLease(leases []activeLease, rcp proto.Recipient, above uint64) *activeLease {
+	for i := range leases {
+		if leases[i].Recipient.String() == rcp.String() && leases[i].Amount > above {
+			return &leases[i]
+		}
+	}
+	return nil
+}
+
+func getLeaseTimestamp(ctx context.Context, cl *node, l activeLease) (uint64, error) {
+	if l.Timestamp != 0 {
+		return l.Timestamp, nil
+	}
+	tx, _, err := cl.Transactions.Info(ctx, l.originID())
+	if err != nil {
+		return 0, err
+	}
+	return tx.GetTimestamp(), nil
+}
+
+func findRecentLease(ctx context.Context, cl *node, addr proto.WavesAddress, since uint64) (*activeLease, uint64, error) {
+	leases, err := getActiveLeases(ctx, cl, addr)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, l := range leases { // Leases are sorted from the newest to the oldest
+		ts, err := getLeaseTimestamp(ctx, cl, l)
+		if err != nil {
+			return nil, 0, err
+		}
+		if ts < since {
+			break
+		}
+		return &l, ts, nil
+	}
+	return nil, 0, nil
+}
+
+func newLeaseCancel(scheme proto.Scheme, txVer byte, sk crypto.SecretKey, pk crypto.PublicKey, id crypto.Digest, fee, ts uint64) (*proto.LeaseCancelWithProofs, error) {
+	tx := proto.NewUnsignedLeaseCancelWithProofs(txVer, scheme, pk, id, fee, ts)
+	if err := tx.Sign(scheme, sk); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func totalLeased(leases []activeLease) (uint64, error) {
+	var total uint64
+	for _, l := range leases {
+		var err error
+		total, err = addAmounts(total, l.Amount)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+type leaseTarget struct {
+	rcp    proto.Recipient
+	weight uint64
+}
+
+// parseLeaseTargets parses comma-separated list of recipients with optional weights, like 'addr1:60,alias:W:name:40'.
+// Recipients without weight have weight of 1.
+func parseLeaseTargets(s string) ([]leaseTarget, error) {
+	var r []leaseTarget
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return nil, errors.New("empty recipient")
+		}
+		n := 0 // Number of colons in recipient without weight
+		if strings.HasPrefix(item, proto.AliasPrefix+":") {
+			n = 2
+		}
+		var weight uint64 = 1
+		if i := strings.LastIndexByte(item, ':'); i >= 0 && strings.Count(item, ":") > n {
+			w, err := strconv.ParseUint(item[i+1:], 10, 64)
+			if err != nil || w == 0 {
+				return nil, fmt.Errorf("invalid weight of recipient '%s'", item)
+			}
+			weight = w
+			item = item[:i]
+		}
+		rcp, err := parseRecipient(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient '%s': %w", item, err)
+		}
+		for _, t := range r {
+			if t.rcp.String() == rcp.String() {
+				return nil, fmt.Errorf("duplicate recipient '%s'", item)
+			}
+		}
+		r = append(r, leaseTarget{rcp: rcp, weight: weight})
+	}
+	return r, nil
+}
+
+const (
+	roundingFirst   = "first"
+	roundingLast    = "last"
+	roundingLargest = "largest"
+	roundingDrop    = "drop"
+)
+
+// splitAmount divides the amount proportionally to weights of targets.
+// The remainder of integer division goes to the first or the last target, or to the target with the largest weight,
+// depending on rounding mode. With drop mode the remainder is not leased. The remainder is returned along with shares.
+func splitAmount(amount uint64, targets []leaseTarget, rounding string) ([]uint64, uint64, error) {
+	var total uint64
+	for _, t := range targets {
+		s, c := bits.Add64(total, t.weight, 0)
+		if c != 0 {
+			return nil, 0, errOverflow
+		}
+		total = s
+	}
+	if total == 0 {
+		return nil, 0, errors.New("zero total weight")
+	}
+	shares := make([]uint64, len(targets))
+	var sum uint64
+	for i, t := range targets {
+		hi, lo := bits.Mul64(amount, t.weight)
+		shares[i], _ = bits.Div64(hi, lo, total) // No overflow because weight is not bigger than total
+		sum += shares[i]
+	}
+	rem := amount - sum // Less than the number of targets
+	switch rounding {
+	case roundingFirst:
+		shares[0] += rem
+	case roundingLast:
+		shares[len(shares)-1] += rem
+	case roundingLargest:
+		l := 0
+		for i, t := range targets {
+			if t.weight > targets[l].weight {
+				l = i
+			}
+		}
+		shares[l] += rem
+	case roundingDrop:
+	default:
+		return nil, 0, fmt.Errorf("invalid rounding '%s'", rounding)
+	}
+	return shares, rem, nil
+}
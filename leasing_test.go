@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/wavesplatform/gowaves/pkg/client"
+	"github.com/wavesplatform/gowaves/pkg/crypto"
+	pb "github.com/wavesplatform/gowaves/pkg/grpc/generated/waves"
+	g "github.com/wavesplatform/gowaves/pkg/grpc/generated/waves/node/grpc"
+	"github.com/wavesplatform/gowaves/pkg/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func testDigest(b byte) crypto.Digest {
+	var d crypto.Digest
+	for i := range d {
+		d[i] = b
+	}
+	return d
+}
+
+func checkActiveLeases(t *testing.T, leases []activeLease, rcp proto.WavesAddress) {
+	t.Helper()
+	if len(leases) != 2 {
+		t.Fatalf("got %d leases, want 2 leases of the address", len(leases))
+	}
+	// Leases of other senders are skipped and the rest are sorted from the newest
+	if leases[0].ID != testDigest(2) || leases[0].Height != 20 || leases[1].ID != testDigest(1) || leases[1].Height != 10 {
+		t.Errorf("unexpected leases order %v", leases)
+	}
+	if leases[0].Amount != 2*waves || leases[0].Recipient.String() != rcp.String() {
+		t.Errorf("unexpected lease %v", leases[0])
+	}
+}
+
+func TestGetActiveLeasesREST(t *testing.T) {
+	l, r, o := newTestAccount(t, "lessor"), newTestAccount(t, "recipient"), newTestAccount(t, "other")
+	lease := func(id byte, sender proto.WavesAddress, amount, height uint64) map[string]interface{} {
+		return map[string]interface{}{"id": testDigest(id).String(), "originTransactionId": testDigest(id).String(),
+			"sender": sender.String(), "recipient": r.addr.String(), "amount": amount, "height": height, "status": "active"}
+	}
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		if req.URL.Path != "/leasing/active/"+l.addr.String() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode([]interface{}{
+			lease(1, l.addr, waves, 10), lease(3, o.addr, 3*waves, 30), lease(2, l.addr, 2*waves, 20),
+		})
+	}))
+	defer srv.Close()
+	c, err := client.NewClient(client.Options{BaseUrl: srv.URL, Client: srv.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := getActiveLeases(context.Background(), &node{Client: c}, l.addr); err == nil {
+		t.Fatal("expected error without retries")
+	}
+	calls = 0
+	leases, err := getActiveLeases(context.Background(), &node{Client: c, retries: 1}, l.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("got %d requests, want 2", calls)
+	}
+	checkActiveLeases(t, leases, r.addr)
+}
+
+type testAccountsServer struct {
+	g.UnimplementedAccountsApiServer
+	calls  int
+	leases []*g.LeaseResponse
+}
+
+func (s *testAccountsServer) GetActiveLeases(_ *g.AccountRequest, stream g.AccountsApi_GetActiveLeasesServer) error {
+	s.calls++
+	if s.calls == 1 {
+		return status.Error(codes.Unavailable, "node is starting")
+	}
+	for _, l := range s.leases {
+		if err := stream.Send(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestGetActiveLeasesGRPC(t *testing.T) {
+	l, r, o := newTestAccount(t, "lessor"), newTestAccount(t, "recipient"), newTestAccount(t, "other")
+	lease := func(id byte, sender proto.WavesAddress, amount, height int64) *g.LeaseResponse {
+		d := testDigest(id)
+		return &g.LeaseResponse{LeaseId: d.Bytes(), OriginTransactionId: d.Bytes(), Sender: sender.Bytes(),
+			Recipient: &pb.Recipient{Recipient: &pb.Recipient_PublicKeyHash{PublicKeyHash: r.addr.Body()}},
+			Amount:    amount, Height: height}
+	}
+	as := &testAccountsServer{leases: []*g.LeaseResponse{
+		lease(1, l.addr, waves, 10), lease(3, o.addr, 3*waves, 30), lease(2, l.addr, 2*waves, 20),
+	}}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	g.RegisterAccountsApiServer(srv, as)
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+	gn, err := dialGRPC(lis.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gn.close()
+	gn.scheme = proto.MainNetScheme
+
+	leases, err := getActiveLeases(context.Background(), &node{grpc: gn, retries: 1}, l.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if as.calls != 2 {
+		t.Errorf("got %d calls, want 2", as.calls)
+	}
+	checkActiveLeases(t, leases, r.addr)
+}
+
+func TestSplitAmount(t *testing.T) {
+	targets := func(weights ...uint64) []leaseTarget {
+		r := make([]leaseTarget, len(weights))
+		for i, w := range weights {
+			r[i] = leaseTarget{weight: w}
+		}
+		return r
+	}
+	tests := []struct {
+		name     string
+		amount   uint64
+		targets  []leaseTarget
+		rounding string
+		shares   []uint64
+		rem      uint64
+	}{
+		{"single", 10, targets(3), roundingDrop, []uint64{10}, 0},
+		{"exact", 100, targets(3, 1), roundingFirst, []uint64{75, 25}, 0},
+		{"first", 11, targets(1, 1, 1), roundingFirst, []uint64{5, 3, 3}, 2},
+		{"last", 11, targets(1, 1, 1), roundingLast, []uint64{3, 3, 5}, 2},
+		{"largest", 11, targets(1, 2, 2), roundingLargest, []uint64{2, 5, 4}, 1},
+		{"drop", 11, targets(1, 1, 1), roundingDrop, []uint64{3, 3, 3}, 2},
+		{"max amount", math.MaxUint64, targets(1, 1), roundingFirst, []uint64{math.MaxUint64/2 + 1, math.MaxUint64 / 2}, 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			shares, rem, err := splitAmount(tc.amount, tc.targets, tc.rounding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rem != tc.rem || !reflect.DeepEqual(shares, tc.shares) {
+				t.Errorf("splitAmount() = %v, %d, want %v, %d", shares, rem, tc.shares, tc.rem)
+			}
+		})
+	}
+	if _, _, err := splitAmount(10, targets(1), "middle"); err == nil {
+		t.Error("expected error for invalid rounding")
+	}
+	if _, _, err := splitAmount(10, targets(math.MaxUint64, 1), roundingFirst); err == nil {
+		t.Error("expected error for overflow of total weight")
+	}
+}
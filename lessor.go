@@ -1,16 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
-	"os/signal"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,16 +28,57 @@ const (
 	waves                = 100000000
 	defaultScheme        = "http"
 	standardFee   uint64 = 100000
+
+	featurePollInterval = time.Minute
+
+	maxAttachmentSize = 140
+
+	generatingSKEnv = "WAVES_GENERATING_SK"
+	lessorSKEnv     = "WAVES_LESSOR_SK"
+)
+
+// Exit codes are stable and can be relied upon in scripts.
+const (
+	exitOK                = 0
+	exitError             = 1
+	exitInvalidParameters = 2
+	exitBelowThreshold    = 3
+	exitFailure           = 70
+	exitUserTermination   = 130
 )
 
 var (
-	version              = "v0.0.0"
-	errInvalidParameters = errors.New("invalid parameters")
-	errUserTermination   = errors.New("user termination")
-	errFailure           = errors.New("operation failure")
-	na                   = proto.OptionalAsset{}
+	version                = "v0.0.0"
+	commit                 = ""
+	errInvalidParameters   = errors.New("invalid parameters")
+	errUserTermination     = errors.New("user termination")
+	errFailure             = errors.New("operation failure")
+	errImplausibleScheme   = errors.New("implausible scheme")
+	errConfirmationTimeout = errors.New("confirmation timeout")
+	errRolledBack          = errors.New("transaction rolled back")
+	errBelowThreshold      = errors.New("lease amount below threshold")
+	errNotCredited         = errors.New("transfer is not reflected in balance")
+	errNotWavesNode        = errors.New("response does not look like Waves node API, check the URL")
+	errBulkUnsupported     = errors.New("bulk broadcast is not supported by node")
+	na                     = proto.OptionalAsset{}
 )
 
+type network struct {
+	nodeURL     string
+	chainID     string
+	explorerURL string
+}
+
+var networks = map[string]network{
+	"mainnet":  {nodeURL: "https://nodes.wavesnodes.com", chainID: "W", explorerURL: "https://wavesexplorer.com"},
+	"testnet":  {nodeURL: "https://nodes-testnet.wavesnodes.com", chainID: "T", explorerURL: "https://testnet.wavesexplorer.com"},
+	"stagenet": {nodeURL: "https://nodes-stagenet.wavesnodes.com", chainID: "S", explorerURL: "https://stagenet.wavesexplorer.com"},
+}
+
+type peersResponse struct {
+	Peers []json.RawMessage `json:"peers"`
+}
+
 type feature struct {
 	ID               int    `json:"id"`
 	Description      string `json:"description"`
@@ -51,250 +96,2063 @@ type activationStatusResponse struct {
 }
 
 func main() {
-	err := run()
+	cfg, help, showVersion, err := parseFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		os.Exit(exitInvalidParameters)
+	}
+	if help {
+		showUsage()
+		return
+	}
+	if showVersion {
+		if commit != "" {
+			fmt.Printf("Waves Automatic Lessor %s (commit %s)\n", version, commit)
+		} else {
+			fmt.Printf("Waves Automatic Lessor %s\n", version)
+		}
+		return
+	}
+	level, err := cfg.logLevel()
+	if err == nil {
+		err = setupOutput(cfg.Output, level, cfg.Explain, os.Stderr)
+	}
+	if err != nil {
+		log.Printf("[ERROR] Invalid output: %v", err)
+		showUsage()
+		os.Exit(exitInvalidParameters)
+	}
+	ctx, done := interruptListener(context.Background())
+	err = run(ctx, cfg)
+	done()
 	if err != nil {
-		switch err {
-		case errInvalidParameters:
+		if output == outputJSON && !errors.Is(err, errBelowThreshold) {
+			fs := fields{"status": "failure", "error": err.Error()}
+			var se *StepError
+			if errors.As(err, &se) {
+				fs["step"] = se.Step
+			}
+			logWith(fs, "[ERROR] Failure")
+		}
+		switch {
+		case errors.Is(err, errInvalidParameters):
 			showUsage()
-			os.Exit(2)
-		case errUserTermination:
-			os.Exit(130)
-		case errFailure:
-			os.Exit(70)
+			os.Exit(exitInvalidParameters)
+		case errors.Is(err, errBelowThreshold):
+			os.Exit(exitBelowThreshold)
+		case errors.Is(err, errUserTermination):
+			os.Exit(exitUserTermination)
+		case errors.Is(err, errFailure):
+			os.Exit(exitFailure)
 		default:
-			os.Exit(1)
+			os.Exit(exitError)
 		}
 	}
 }
 
-func run() error {
-	var (
-		nodeURL             string
-		generatingAccountSK string
-		lessorSK            string
-		lessorPK            string
-		leasingAddress      string
-		irreducibleBalance  int64
-		leasingThreshold    int64
-		dryRun              bool
-		testRun             bool
-		showHelp            bool
-		showVersion         bool
-	)
-	flag.StringVar(&nodeURL, "node-api", "http://localhost:6869", "Node's REST API URL")
-	flag.StringVar(&generatingAccountSK, "generating-sk", "", "Base58 encoded private key of generating account")
-	flag.StringVar(&lessorSK, "lessor-sk", "", "Base58 encoded private key of lessor")
-	flag.StringVar(&lessorPK, "lessor-pk", "", "Base58 encoded lessor's public key")
-	flag.StringVar(&leasingAddress, "leasing-address", "", "Base58 encoded leasing address if differs from generating account")
-	flag.Int64Var(&irreducibleBalance, "irreducible-balance", waves, "Irreducible balance on accounts in WAVELETS, default value is 1 Waves")
-	flag.Int64Var(&leasingThreshold, "leasing-threshold", 0, "Leasing amount threshold in WAVELETS, a leasing transaction created only if amount is bigger than the given value")
-	flag.BoolVar(&dryRun, "dry-run", false, "Test execution without creating real transactions on blockchain")
-	flag.BoolVar(&testRun, "test-run", false, "Test execution with limited available balance of 1 WAVES")
-	flag.BoolVar(&showHelp, "help", false, "Show usage information and exit")
-	flag.BoolVar(&showVersion, "version", false, "Print version information and quit")
-	flag.Parse()
-
-	if showHelp {
-		showUsage()
-		return nil
+func run(ctx context.Context, cfg Config) (err error) {
+	step := stepParameters
+	defer func() { err = wrapStep(step, err) }()
+
+	if cfg.Network != "" {
+		n, ok := networks[strings.ToLower(cfg.Network)]
+		if !ok {
+			log.Printf("[ERROR] Unknown network '%s'", cfg.Network)
+			return errInvalidParameters
+		}
+		if cfg.NodeURL == "" {
+			cfg.NodeURL = n.nodeURL
+		}
+		if cfg.ChainID == "" {
+			cfg.ChainID = n.chainID
+		}
+		if cfg.ExpectedScheme == "" { // Node of another network must not be used with the preset
+			cfg.ExpectedScheme = n.chainID
+		}
+		if _, err := cfg.scheme(); err != nil {
+			log.Printf("[ERROR] Blockchain scheme options contradict network '%s': %v", cfg.Network, err)
+			return errInvalidParameters
+		}
+		if cfg.ExplorerURL == "" {
+			cfg.ExplorerURL = n.explorerURL
+		}
+		log.Printf("[INFO] Network '%s': node API '%s', chain ID '%s', explorer '%s'", cfg.Network, cfg.NodeURL, cfg.ChainID, cfg.ExplorerURL)
 	}
-	if showVersion {
-		fmt.Printf("Waves Automatic Lessor %s\n", version)
-		return nil
+	if cfg.NodeURL == "" {
+		cfg.NodeURL = defaultNodeURL
+	}
+	var nodeURLs []string
+	for _, s := range strings.Split(cfg.NodeURL, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" || len(strings.Fields(s)) > 1 {
+			log.Printf("[ERROR] Invalid node's URL '%s'", s)
+			return errInvalidParameters
+		}
+		u, err := normalizeURL(s)
+		if err != nil {
+			log.Printf("[ERROR] Invalid node's URL '%s': %v", s, err)
+			return errInvalidParameters
+		}
+		nodeURLs = append(nodeURLs, u)
+	}
+	if cfg.HTTPTimeout < 0 {
+		log.Printf("[ERROR] Invalid HTTP timeout '%s'", cfg.HTTPTimeout)
+		return errInvalidParameters
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone() // Proxy is taken from environment by default
+	if cfg.ProxyURL != "" {
+		u, err := url.Parse(cfg.ProxyURL)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			log.Printf("[ERROR] Invalid proxy URL '%s'", cfg.ProxyURL)
+			return errInvalidParameters
+		}
+		transport.Proxy = http.ProxyURL(u)
+		log.Printf("[INFO] Connecting to node through proxy '%s'", u.Redacted())
+	}
+	var tc *tls.Config
+	if cfg.TLSInsecure || cfg.TLSCAFile != "" {
+		var err error
+		tc, err = tlsConfig(cfg.TLSInsecure, cfg.TLSCAFile)
+		if err != nil {
+			log.Printf("[ERROR] Invalid TLS configuration: %v", err)
+			return errInvalidParameters
+		}
+		transport.TLSClientConfig = tc
+		if cfg.TLSInsecure {
+			log.Print("[WARN] TLS CERTIFICATE VERIFICATION IS DISABLED, connection to node can be intercepted")
+		} else {
+			log.Printf("[INFO] Trusting certificates of CA from file '%s'", cfg.TLSCAFile)
+		}
+	}
+	var rt http.RoundTripper = transport
+	if len(cfg.HTTPHeaders) > 0 {
+		rt = &headerTransport{base: rt, header: http.Header(cfg.HTTPHeaders)}
+		log.Printf("[INFO] Additional HTTP headers: %s", cfg.HTTPHeaders.String())
+	}
+	if level, _ := cfg.logLevel(); level == "debug" {
+		rt = &debugTransport{base: rt}
+	}
+	hc := &http.Client{Timeout: cfg.HTTPTimeout, Transport: rt}
+	var gn *grpcNode
+	if cfg.GRPCAddr != "" {
+		n, err := dialGRPC(cfg.GRPCAddr, tc)
+		if err != nil {
+			log.Printf("[ERROR] Invalid gRPC address '%s': %v", cfg.GRPCAddr, err)
+			return errInvalidParameters
+		}
+		defer func() {
+			if err := n.close(); err != nil {
+				log.Printf("[WARN] Failed to close gRPC connection: %v", err)
+			}
+		}()
+		gn = n
+		log.Printf("[INFO] Using gRPC API at '%s' for balances, active leases, broadcasting and tracking", cfg.GRPCAddr)
 	}
-	if nodeURL == "" || len(strings.Fields(nodeURL)) > 1 {
-		log.Printf("[ERROR] Invalid node's URL '%s'", nodeURL)
+	if cfg.MaxBlockAge < 0 {
+		log.Printf("[ERROR] Invalid maximum block age '%s'", cfg.MaxBlockAge)
 		return errInvalidParameters
 	}
-	if generatingAccountSK == "" || len(strings.Fields(generatingAccountSK)) > 1 {
-		log.Printf("[ERROR] Invalid generating account private key '%s'", generatingAccountSK)
+	if cfg.Probe {
+		return probeNode(ctx, nodeURLs, hc, cfg.MaxBlockAge)
+	}
+	if cfg.GeneratingSeedNonce > math.MaxUint32 || cfg.LessorSeedNonce > math.MaxUint32 {
+		log.Print("[ERROR] Seed nonce is too big")
 		return errInvalidParameters
 	}
-	if lessorSK == "" || len(strings.Fields(lessorSK)) > 1 {
-		log.Printf("[ERROR] Invalid lessor private key '%s'", lessorSK)
+	var generatingAccountSK string
+	var extraGeneratingSKs []string
+	if len(cfg.GeneratingSKs) > 0 {
+		generatingAccountSK, extraGeneratingSKs = cfg.GeneratingSKs[0], cfg.GeneratingSKs[1:]
+	}
+	if generatingAccountSK == "" && cfg.GeneratingSKFile == "" && cfg.GeneratingSKRef == "" && cfg.GeneratingSeed == "" && cfg.KeystoreGenerating == "" {
+		generatingAccountSK = os.Getenv(generatingSKEnv)
+	}
+	if cfg.LessorSK == "" && cfg.LessorSKFile == "" && cfg.LessorSKRef == "" && cfg.LessorSeed == "" && cfg.KeystoreLessor == "" {
+		cfg.LessorSK = os.Getenv(lessorSKEnv)
+	}
+	var (
+		generatingKeystore   *keystoreProvider
+		lessorKeystore       *keystoreProvider
+		generatingSKProvider secretProvider
+		lessorSKProvider     secretProvider
+	)
+	if (cfg.KeystoreGenerating != "" || cfg.KeystoreLessor != "") != (cfg.KeystoreFile != "") {
+		log.Print("[ERROR] Keystore file and at least one of -keystore-generating and -keystore-lessor must be given together")
 		return errInvalidParameters
 	}
+	if cfg.KeystorePassword == "" {
+		cfg.KeystorePassword = os.Getenv(keystorePasswordEnv)
+	}
+	if cfg.KeystoreGenerating != "" {
+		generatingKeystore, err = newKeystoreProvider(cfg.KeystoreFile, cfg.KeystorePassword, cfg.KeystoreGenerating)
+		if err != nil {
+			log.Printf("[ERROR] Invalid keystore: %v", err)
+			return errInvalidParameters
+		}
+	}
+	if cfg.KeystoreLessor != "" {
+		lessorKeystore, err = newKeystoreProvider(cfg.KeystoreFile, cfg.KeystorePassword, cfg.KeystoreLessor)
+		if err != nil {
+			log.Printf("[ERROR] Invalid keystore: %v", err)
+			return errInvalidParameters
+		}
+	}
+	if cfg.BroadcastFile == "" {
+		generatingSKProvider, err = selectSKProvider(generatingAccountSK, cfg.GeneratingSKFile, cfg.GeneratingSKRef, cfg.GeneratingSeed, uint32(cfg.GeneratingSeedNonce), generatingKeystore)
+		if err != nil {
+			log.Printf("[ERROR] Invalid generating account private key: %v", err)
+			return errInvalidParameters
+		}
+		for _, sk := range extraGeneratingSKs {
+			if _, err := selectSKProvider(sk, "", "", "", 0, nil); err != nil {
+				log.Printf("[ERROR] Invalid generating account private key: %v", err)
+				return errInvalidParameters
+			}
+		}
+		lessorSKProvider, err = selectSKProvider(cfg.LessorSK, cfg.LessorSKFile, cfg.LessorSKRef, cfg.LessorSeed, uint32(cfg.LessorSeedNonce), lessorKeystore)
+		if err != nil {
+			log.Printf("[ERROR] Invalid lessor private key: %v", err)
+			return errInvalidParameters
+		}
+	}
 	var differentLessorPK *crypto.PublicKey = nil
-	if lessorPK == "" {
-		lessorPK = ""
+	if cfg.LessorPK == "" {
+		cfg.LessorPK = ""
 		log.Print("[INFO] No different lessor public key is given")
 	} else {
-		pk, err := crypto.NewPublicKeyFromBase58(lessorPK)
+		pk, err := crypto.NewPublicKeyFromBase58(cfg.LessorPK)
 		if err != nil {
-			log.Printf("[ERROR] Failed to parse additional lessor public key'%s': %v", lessorPK, err)
+			log.Printf("[ERROR] Failed to parse additional lessor public key'%s': %v", cfg.LessorPK, err)
 			return errFailure
 		}
 		differentLessorPK = &pk
 	}
-	var leasingAddr *proto.WavesAddress = nil
-	if leasingAddress == "" {
-		log.Printf("[INFO] No different leasing address is given")
+	var allowlist []proto.Recipient
+	if cfg.AllowlistFile != "" {
+		allowlist, err = loadAllowlist(cfg.AllowlistFile)
+		if err != nil {
+			log.Printf("[ERROR] Invalid recipient allowlist: %v", err)
+			return errInvalidParameters
+		}
+		log.Printf("[INFO] Recipients are limited to %d from allowlist '%s'", len(allowlist), cfg.AllowlistFile)
+	}
+	var leasingTargets []leaseTarget
+	if cfg.LeaseToSelf && cfg.LeasingAddress != "" {
+		log.Print("[ERROR] Options -lease-to-self and -leasing-address are mutually exclusive")
+		return errInvalidParameters
+	}
+	if cfg.LeasingAddress == "" {
+		if !cfg.LeaseToSelf && cfg.StrictConfig {
+			log.Print("[ERROR] STRICT-CONFIG: Either -leasing-address or -lease-to-self must be given")
+			return errInvalidParameters
+		}
+		log.Print("[INFO] Leasing mode: to generating account itself")
 	} else {
-		a, err := proto.NewAddressFromString(leasingAddress)
+		log.Print("[INFO] Leasing mode: to different leasing address")
+		targets, err := parseLeaseTargets(cfg.LeasingAddress)
+		if err != nil {
+			log.Printf("[ERROR] Invalid leasing address '%s': %v", cfg.LeasingAddress, err)
+			return errFailure
+		}
+		leasingTargets = targets
+	}
+	if _, err := cfg.scheme(); err != nil {
+		log.Printf("[ERROR] Invalid blockchain scheme: %v", err)
+		return errInvalidParameters
+	}
+	if cfg.SkipIfActiveLease && cfg.CoalesceLeases {
+		log.Print("[ERROR] Options -skip-if-active-lease and -coalesce-leases are mutually exclusive")
+		return errInvalidParameters
+	}
+	var cancelID *crypto.Digest
+	if cfg.CancelLeaseID != "" {
+		id, err := crypto.NewDigestFromBase58(cfg.CancelLeaseID)
+		if err != nil {
+			log.Printf("[ERROR] Invalid lease ID '%s': %v", cfg.CancelLeaseID, err)
+			return errInvalidParameters
+		}
+		if cfg.CoalesceLeases {
+			log.Print("[ERROR] Options -cancel-lease and -coalesce-leases are mutually exclusive")
+			return errInvalidParameters
+		}
+		cancelID = &id
+	}
+	var withdrawal *proto.Recipient
+	if cfg.WithdrawalAddress != "" && !cfg.Unwind {
+		log.Print("[ERROR] Option -withdrawal-address requires -unwind")
+		return errInvalidParameters
+	}
+	if cfg.Unwind {
+		if cancelID != nil || cfg.CoalesceLeases {
+			log.Print("[ERROR] Option -unwind can't be combined with -cancel-lease or -coalesce-leases")
+			return errInvalidParameters
+		}
+		if cfg.WithdrawalAddress != "" {
+			rcp, err := parseRecipient(cfg.WithdrawalAddress)
+			if err != nil {
+				log.Printf("[ERROR] Invalid withdrawal address '%s': %v", cfg.WithdrawalAddress, err)
+				return errInvalidParameters
+			}
+			withdrawal = &rcp
+		}
+		log.Print("[INFO] UNWIND: Leases of lessor will be cancelled and its balance transferred to withdrawal address")
+	}
+	if cfg.IrreducibleBalance < 0 {
+		log.Printf("[ERROR] Invalid irreducible balance value '%d'", cfg.IrreducibleBalance)
+		return errInvalidParameters
+	}
+	if cfg.IrreducibleBalance > 0 {
+		log.Printf("[INFO] Accounts irreducible balance set to %s", format(uint64(cfg.IrreducibleBalance)))
+	}
+	if cfg.MaxAmountPerDay < 0 {
+		log.Printf("[ERROR] Invalid maximum amount per day '%d'", cfg.MaxAmountPerDay)
+		return errInvalidParameters
+	}
+	if cfg.MaxAmountPerDay > 0 && cfg.StateFile == "" {
+		log.Print("[ERROR] State file is required to limit amount per day")
+		return errInvalidParameters
+	}
+	if cfg.LeaseNoteExpiry < 0 {
+		log.Printf("[ERROR] Invalid lease note expiry '%s'", cfg.LeaseNoteExpiry)
+		return errInvalidParameters
+	}
+	if cfg.LeaseNoteExpiry > 0 && cfg.StateFile == "" {
+		log.Print("[ERROR] State file is required to note lease expiry")
+		return errInvalidParameters
+	}
+	var st *state = nil
+	if cfg.StateFile != "" {
+		var err error
+		st, err = loadState(cfg.StateFile)
 		if err != nil {
-			log.Printf("[ERROR] Invalid leasing address '%s': %v", leasingAddress, err)
+			log.Printf("[ERROR] Failed to load state from file '%s': %v", cfg.StateFile, err)
 			return errFailure
 		}
-		leasingAddr = &a
 	}
-	if irreducibleBalance < 0 {
-		log.Printf("[ERROR] Invalid irreducible balance value '%d'", irreducibleBalance)
+	if cfg.AbortIfLeasedRecently < 0 {
+		log.Printf("[ERROR] Invalid recent lease duration '%s'", cfg.AbortIfLeasedRecently)
+		return errInvalidParameters
+	}
+	if cfg.MinPeers < 0 {
+		log.Printf("[ERROR] Invalid minimal number of peers '%d'", cfg.MinPeers)
+		return errInvalidParameters
+	}
+	if cfg.TimestampOffset != 0 {
+		log.Printf("[INFO] Timestamps of transactions are shifted by %s", cfg.TimestampOffset)
+	}
+	if cfg.MaxClockSkew < 0 {
+		log.Printf("[ERROR] Invalid maximum clock skew '%s'", cfg.MaxClockSkew)
+		return errInvalidParameters
+	}
+	if cfg.ProtobufFeature <= 0 {
+		log.Printf("[ERROR] Invalid Protobuf feature ID '%d'", cfg.ProtobufFeature)
+		return errInvalidParameters
+	}
+	if cfg.TxVersion != 0 && (cfg.TxVersion < 2 || cfg.TxVersion > proto.MaxLeaseTransactionVersion || cfg.TxVersion > proto.MaxLeaseCancelTransactionVersion) {
+		log.Printf("[ERROR] Unsupported transaction version '%d'", cfg.TxVersion)
+		return errInvalidParameters
+	}
+	if cfg.RequiredFeature < 0 {
+		log.Printf("[ERROR] Invalid required feature ID '%d'", cfg.RequiredFeature)
+		return errInvalidParameters
+	}
+	if cfg.WaitForFeature && cfg.RequiredFeature == 0 {
+		log.Print("[ERROR] No required feature to wait for is given")
+		return errInvalidParameters
+	}
+	if cfg.TrackInitialDelay < 0 {
+		log.Printf("[ERROR] Invalid track initial delay '%s'", cfg.TrackInitialDelay)
+		return errInvalidParameters
+	}
+	if cfg.ConfirmationTimeout <= 0 {
+		log.Printf("[ERROR] Invalid confirmation timeout '%s'", cfg.ConfirmationTimeout)
+		return errInvalidParameters
+	}
+	if cfg.PollInterval <= 0 {
+		log.Printf("[ERROR] Invalid poll interval '%s'", cfg.PollInterval)
+		return errInvalidParameters
+	}
+	if cfg.MaxPollInterval < 0 {
+		log.Printf("[ERROR] Invalid maximum poll interval '%s'", cfg.MaxPollInterval)
+		return errInvalidParameters
+	}
+	if cfg.Confirmations < 1 {
+		log.Printf("[ERROR] Invalid number of confirmations '%d'", cfg.Confirmations)
+		return errInvalidParameters
+	}
+	var hook *webhook
+	to := trackOptions{initialDelay: cfg.TrackInitialDelay, timeout: cfg.ConfirmationTimeout, pollInterval: cfg.PollInterval, maxPollInterval: cfg.MaxPollInterval, confirmations: cfg.Confirmations}
+	if cfg.WebhookURL != "" {
+		u, err := url.Parse(cfg.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Printf("[ERROR] Invalid webhook URL '%s'", cfg.WebhookURL)
+			return errInvalidParameters
+		}
+		hook = newWebhook(cfg.WebhookURL)
+	}
+	defer func() {
+		if err != nil && !errors.Is(err, errBelowThreshold) && !errors.Is(err, errUserTermination) {
+			hook.failure(wrapStep(step, err))
+		}
+	}()
+	if cfg.Deadline < 0 {
+		log.Printf("[ERROR] Invalid deadline '%s'", cfg.Deadline)
+		return errInvalidParameters
+	}
+	if cfg.Interval < 0 {
+		log.Printf("[ERROR] Invalid interval '%s'", cfg.Interval)
+		return errInvalidParameters
+	}
+	if cfg.ReportOnlyChanged && cfg.Interval == 0 {
+		log.Print("[ERROR] Option -report-only-changed requires -interval")
+		return errInvalidParameters
+	}
+	if cfg.MaxIterations < 0 {
+		log.Printf("[ERROR] Invalid maximum number of iterations '%d'", cfg.MaxIterations)
+		return errInvalidParameters
+	}
+	if !(cfg.FeeMultiplier >= 1) || math.IsInf(cfg.FeeMultiplier, 0) {
+		log.Printf("[ERROR] Invalid fee multiplier '%g', must be at least 1", cfg.FeeMultiplier)
+		return errInvalidParameters
+	}
+	if cfg.FeeMultiplier != 1 {
+		log.Printf("[INFO] Fees are multiplied by %g", cfg.FeeMultiplier)
+	}
+	if cfg.MaxFee < 0 {
+		log.Printf("[ERROR] Invalid maximum fee '%d'", cfg.MaxFee)
+		return errInvalidParameters
+	}
+	if cfg.MaxFee > 0 {
+		log.Printf("[INFO] Maximum fee of a transaction: %s", format(uint64(cfg.MaxFee)))
+	}
+	if cfg.MaxFeeRatio < 0 {
+		log.Printf("[ERROR] Invalid maximum fee ratio '%f'", cfg.MaxFeeRatio)
+		return errInvalidParameters
+	}
+	if cfg.MaxAmountPerDay > 0 {
+		log.Printf("[INFO] Amount per day limited to %s", format(uint64(cfg.MaxAmountPerDay)))
+	}
+	if len(cfg.TransferAttachment) > maxAttachmentSize {
+		log.Printf("[ERROR] Transfer attachment of %d bytes exceeds maximum of %d bytes", len(cfg.TransferAttachment), maxAttachmentSize)
+		return errInvalidParameters
+	}
+	var feeAsset proto.OptionalAsset
+	if cfg.FeeAssetID != "" {
+		d, err := crypto.NewDigestFromBase58(cfg.FeeAssetID)
+		if err != nil {
+			log.Printf("[ERROR] Invalid fee asset ID '%s': %v", cfg.FeeAssetID, err)
+			return errInvalidParameters
+		}
+		feeAsset = *proto.NewOptionalAssetFromDigest(d)
+		log.Printf("[INFO] Transfer fee is paid in asset '%s', lease fee is paid in WAVES", cfg.FeeAssetID)
+	}
+	switch cfg.Rounding {
+	case roundingFirst, roundingLast, roundingLargest, roundingDrop:
+	default:
+		log.Printf("[ERROR] Invalid rounding '%s'", cfg.Rounding)
+		return errInvalidParameters
+	}
+	switch cfg.BalanceSource {
+	case balanceAvailable:
+	case balanceGenerating, balanceEffective:
+		log.Printf("[INFO] Transfer and lease are based on %s balance", cfg.BalanceSource)
+	default:
+		log.Printf("[ERROR] Invalid balance source '%s'", cfg.BalanceSource)
+		return errInvalidParameters
+	}
+	if cfg.TransferPercent < 1 || cfg.TransferPercent > 100 {
+		log.Printf("[ERROR] Invalid transfer percent '%d', must be from 1 to 100", cfg.TransferPercent)
+		return errInvalidParameters
+	}
+	if cfg.TransferPercent < 100 {
+		log.Printf("[INFO] Transfer is limited to %d%% of available balance", cfg.TransferPercent)
+	}
+	if cfg.TransferAmount < 0 {
+		log.Printf("[ERROR] Invalid transfer amount '%d'", cfg.TransferAmount)
+		return errInvalidParameters
+	}
+	if cfg.TransferAmount > 0 {
+		if cfg.TransferPercent < 100 {
+			log.Print("[ERROR] Options -transfer-amount and -transfer-percent are mutually exclusive")
+			return errInvalidParameters
+		}
+		log.Printf("[INFO] Transfer amount is fixed to %s", format(uint64(cfg.TransferAmount)))
+	}
+	if cfg.LeaseAmount < 0 {
+		log.Printf("[ERROR] Invalid lease amount '%d'", cfg.LeaseAmount)
+		return errInvalidParameters
+	}
+	if cfg.LeaseAmount > 0 {
+		if cfg.CoalesceLeases {
+			log.Print("[ERROR] Options -lease-amount and -coalesce-leases are mutually exclusive")
+			return errInvalidParameters
+		}
+		log.Printf("[INFO] Lease amount is fixed to %s", format(uint64(cfg.LeaseAmount)))
+	}
+	if cfg.RoundLease {
+		log.Print("[INFO] Lease amounts are rounded down to whole WAVES")
+	}
+	if cfg.MinStartBalance < 0 {
+		log.Printf("[ERROR] Invalid minimal start balance '%d'", cfg.MinStartBalance)
+		return errInvalidParameters
+	}
+	if cfg.BalanceAlert < 0 {
+		log.Printf("[ERROR] Invalid balance alert threshold '%d'", cfg.BalanceAlert)
+		return errInvalidParameters
+	}
+	if cfg.BroadcastRetries < 0 {
+		log.Printf("[ERROR] Invalid number of broadcast retries '%d'", cfg.BroadcastRetries)
+		return errInvalidParameters
+	}
+	if cfg.APIRetries < 0 {
+		log.Printf("[ERROR] Invalid number of API retries '%d'", cfg.APIRetries)
+		return errInvalidParameters
+	}
+	if cfg.SponsorshipReserve < 0 {
+		log.Printf("[ERROR] Invalid sponsorship reserve value '%d'", cfg.SponsorshipReserve)
+		return errInvalidParameters
+	}
+	if cfg.SponsorshipReserve > 0 {
+		log.Printf("[INFO] Lessor's balance reserved for sponsorship set to %s", format(uint64(cfg.SponsorshipReserve)))
+	}
+	if cfg.LessorFeeReserve < 0 {
+		log.Printf("[ERROR] Invalid lessor fee reserve value '%d'", cfg.LessorFeeReserve)
 		return errInvalidParameters
 	}
-	if irreducibleBalance > 0 {
-		log.Printf("[INFO] Accounts irreducible balance set to %s", format(uint64(irreducibleBalance)))
+	if cfg.LessorFeeReserve > 0 {
+		log.Printf("[INFO] Lessor's balance reserved for fees set to %s", format(uint64(cfg.LessorFeeReserve)))
 	}
-	if testRun {
+	if cfg.TestRun {
 		log.Printf("[INFO] TEST-RUN: Available balance will be limited to %s", format(waves))
 	}
-	if dryRun {
+	interactive := cfg.Interactive
+	if interactive && !isTerminal(os.Stdin) {
+		log.Print("[WARN] Standard input is not a terminal, option -interactive is ignored")
+		interactive = false
+	}
+	if cfg.RawOut != "" {
+		if !rawFormats[cfg.RawFormat] {
+			log.Printf("[ERROR] Invalid raw output format '%s'", cfg.RawFormat)
+			return errInvalidParameters
+		}
+		if err := os.WriteFile(cfg.RawOut, nil, 0600); err != nil {
+			log.Printf("[ERROR] Failed to create raw output file '%s': %v", cfg.RawOut, err)
+			return errFailure
+		}
+		log.Printf("[INFO] RAW-OUT: Transactions will be written to file '%s' in %s format instead of broadcasting", cfg.RawOut, cfg.RawFormat)
+		cfg.DryRun = true
+	}
+	if cfg.SignOnly != (cfg.OutputFile != "") {
+		log.Print("[ERROR] Options -sign-only and -output-file must be given together")
+		return errInvalidParameters
+	}
+	if cfg.BroadcastFile != "" && (cfg.SignOnly || cfg.RawOut != "" || cfg.DryRun) {
+		log.Print("[ERROR] Option -broadcast-file can't be combined with -sign-only, -raw-out or -dry-run")
+		return errInvalidParameters
+	}
+	if cfg.SignOnly {
+		if err := os.WriteFile(cfg.OutputFile, nil, 0600); err != nil {
+			log.Printf("[ERROR] Failed to create output file '%s': %v", cfg.OutputFile, err)
+			return errFailure
+		}
+		log.Printf("[INFO] SIGN-ONLY: Signed transactions will be written to file '%s' instead of broadcasting", cfg.OutputFile)
+		cfg.DryRun = true
+	}
+	if cfg.DryRun {
 		log.Print("[INFO] DRY-RUN: No actual transactions will be created")
 	}
 
-	ctx, done := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer done()
+	if cfg.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Deadline)
+		defer cancel()
+		defer func() {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				log.Printf("[ERROR] Deadline of %s exceeded, aborting", cfg.Deadline)
+			}
+		}()
+	}
 
-	// 1. Check connection to node's API
-	cl, err := nodeClient(ctx, nodeURL)
-	if err != nil {
-		if errors.Is(err, context.Canceled) {
-			return errUserTermination
+	var m *metrics
+	if cfg.MetricsAddr != "" {
+		m = new(metrics)
+		stop, err := serveMetrics(cfg.MetricsAddr, m)
+		if err != nil {
+			log.Printf("[ERROR] Failed to serve metrics on '%s': %v", cfg.MetricsAddr, err)
+			return errFailure
 		}
-		log.Printf("[ERROR] Failed to connect to node at '%s': %v", nodeURL, err)
-		return errFailure
+		defer stop()
 	}
-	log.Printf("[INFO] Successfully connected to '%s'", cl.GetOptions().BaseUrl)
 
-	// 2. Acquire the network scheme from genesis block and Protobuf activation status
-	scheme, err := getScheme(ctx, cl)
+	// 1. Check connection to node's API
+	step = stepConnection
+	rc, err := connectNode(ctx, nodeURLs, hc)
 	if err != nil {
 		if errors.Is(err, context.Canceled) {
 			return errUserTermination
 		}
-		log.Printf("[ERROR] Failed to aquire blockchain scheme: %v", err)
-		return errFailure
+		log.Printf("[ERROR] Failed to connect to node: %v", err)
+		return failure(err)
 	}
-	log.Printf("[INFO] Blockchain scheme: %s", string(scheme))
-	protobuf, err := isProtobufActivated(ctx, cl)
-	if err != nil {
+	cl := &node{Client: rc, grpc: gn, retries: cfg.APIRetries, confirm: interactive}
+	log.Printf("[INFO] Successfully connected to '%s'", cl.GetOptions().BaseUrl)
+	if v, err := getNodeVersion(ctx, cl); err != nil {
 		if errors.Is(err, context.Canceled) {
 			return errUserTermination
 		}
-		log.Printf("[ERROR] Failed to check Protobuf activation status: %v", err)
-		return errFailure
-	}
-	var txVer byte = 2
-	if protobuf {
-		txVer = 3
+		log.Printf("[WARN] Failed to get node version: %v", err)
+	} else {
+		log.Printf("[INFO] Node version: %s", v)
 	}
-	log.Printf("[INFO] Version of transactions to produce: %d", txVer)
-
-	// 3. Generate public keys and addresses from given private keys
-	gSK, gPK, gAddr, err := parseSK(scheme, generatingAccountSK)
-	if err != nil {
-		log.Printf("[ERROR] Failed to parse generating private key: %v", err)
-		return errFailure
+	if cfg.MaxClockSkew > 0 {
+		skew, err := getClockSkew(ctx, cl, cfg.TimestampOffset)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return errUserTermination
+			}
+			log.Printf("[ERROR] Failed to get node's time: %v", err)
+			return errFailure
+		}
+		log.Printf("[INFO] Local clock differs from node's clock by %s", skew)
+		if skew > cfg.MaxClockSkew || skew < -cfg.MaxClockSkew {
+			log.Printf("[ERROR] Clock skew exceeds maximum of %s, check the system time or use -timestamp-offset %s", cfg.MaxClockSkew, cfg.TimestampOffset-skew)
+			return errFailure
+		}
 	}
-	log.Printf("[INFO] Generating address: %s", gAddr.String())
-	lSK, lPK, lAddr, err := parseSK(scheme, lessorSK)
-	if err != nil {
-		log.Printf("[ERROR] Failed to parse lessor private key: %v", err)
-		return errFailure
+	if cfg.MaxBlockAge > 0 {
+		age, err := getLastBlockAge(ctx, cl)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return errUserTermination
+			}
+			log.Printf("[ERROR] Failed to get node's last block: %v", err)
+			return errFailure
+		}
+		log.Printf("[INFO] Node's last block is %s old", age)
+		if age > cfg.MaxBlockAge {
+			log.Printf("[ERROR] Node lags behind by %s, more than maximum of %s, it may be not synchronized", age, cfg.MaxBlockAge)
+			return errFailure
+		}
 	}
-	if differentLessorPK != nil { // Override lessor's PK and address
-		lPK = *differentLessorPK
-		lAddr, err = proto.NewAddressFromPublicKey(scheme, lPK)
+	if cfg.MinPeers > 0 {
+		peers, err := getConnectedPeersCount(ctx, cl)
 		if err != nil {
-			log.Printf("[ERROR] Failed to make lessor address from public key: %v", err)
+			if errors.Is(err, context.Canceled) {
+				return errUserTermination
+			}
+			log.Printf("[ERROR] Failed to get connected peers: %v", err)
+			return errFailure
+		}
+		log.Printf("[INFO] Node has %d connected peers", peers)
+		if peers < cfg.MinPeers {
+			log.Printf("[ERROR] Not enough connected peers, at least %d required", cfg.MinPeers)
+			return errFailure
+		}
+	}
+
+	// 2. Acquire the network scheme from genesis block and Protobuf activation status
+	step = stepScheme
+	var scheme proto.Scheme
+	if cfg.Scheme != "" {
+		scheme = cfg.Scheme[0]
+		log.Printf("[INFO] Blockchain scheme: %s (explicitly set)", string(scheme))
+	} else {
+		scheme, err = getScheme(ctx, cl)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return errUserTermination
+			}
+			if !errors.Is(err, errImplausibleScheme) || cfg.ChainID == "" {
+				log.Printf("[ERROR] Failed to aquire blockchain scheme: %v", err)
+				return failure(err)
+			}
+			log.Printf("[WARN] Failed to detect blockchain scheme (%v), falling back to chain ID '%s'", err, cfg.ChainID)
+			scheme = cfg.ChainID[0]
+		}
+		log.Printf("[INFO] Blockchain scheme: %s", string(scheme))
+	}
+	if cfg.ExpectedScheme != "" && scheme != cfg.ExpectedScheme[0] {
+		log.Printf("[ERROR] Blockchain scheme '%s' differs from expected '%s', check that the node is on the right network",
+			string(scheme), cfg.ExpectedScheme)
+		return errInvalidParameters
+	}
+	if cl.grpc != nil {
+		cl.grpc.scheme = scheme
+	}
+	for _, t := range leasingTargets {
+		if as := recipientScheme(t.rcp); as != scheme {
+			log.Printf("[ERROR] Leasing address '%s' belongs to network with scheme '%s', expected '%s'",
+				t.rcp.String(), string(as), string(scheme))
+			return errInvalidParameters
+		}
+	}
+	if withdrawal != nil {
+		if as := recipientScheme(*withdrawal); as != scheme {
+			log.Printf("[ERROR] Withdrawal address '%s' belongs to network with scheme '%s', expected '%s'",
+				withdrawal.String(), string(as), string(scheme))
+			return errInvalidParameters
+		}
+	}
+	if cfg.BroadcastFile != "" {
+		step = stepBroadcast
+		return broadcastSigned(ctx, cl, scheme, cfg.BroadcastFile, cfg.BroadcastRetries, to)
+	}
+
+	// 3. Generate public keys and addresses from given private keys
+	step = stepAccounts
+	for _, ks := range []*keystoreProvider{generatingKeystore, lessorKeystore} {
+		if ks == nil {
+			continue
+		}
+		if err := ks.resolve(ctx, cl); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return errUserTermination
+			}
+			log.Printf("[ERROR] Failed to find keystore account: %v", err)
+			return errFailure
+		}
+		if as := ks.addr.Bytes()[1]; as != scheme {
+			log.Printf("[ERROR] Keystore account '%s' belongs to network with scheme '%s', expected '%s'", ks.account, string(as), string(scheme))
+			return errInvalidParameters
+		}
+	}
+	generators := make([]generatorAccount, 0, 1+len(extraGeneratingSKs))
+	for i, s := range append([]string{generatingAccountSK}, extraGeneratingSKs...) {
+		var p secretProvider
+		if i == 0 {
+			p = generatingSKProvider
+		}
+		sk, pk, addr, err := loadSK(ctx, scheme, s, p)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return errUserTermination
+			}
+			log.Printf("[ERROR] Failed to parse generating private key: %v", err)
+			return errFailure
+		}
+		for _, g := range generators {
+			if g.addr == addr {
+				log.Printf("[ERROR] Generating account '%s' is given more than once", addr.String())
+				return errInvalidParameters
+			}
+		}
+		log.Printf("[INFO] Generating address: %s", addr.String())
+		generators = append(generators, generatorAccount{sk: sk, pk: pk, addr: addr})
+	}
+	step = stepChecks
+	if cfg.MinStartBalance > 0 && cfg.Interval == 0 && len(generators) == 1 {
+		ok, err := checkStartBalance(ctx, cl, generators[0].addr, uint64(cfg.MinStartBalance))
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return errUserTermination
+			}
+			log.Printf("[ERROR] Failed to get generator WAVES balance: %v", err)
+			return errFailure
+		}
+		if !ok {
+			return nil
+		}
+	}
+	protobuf, err := isProtobufActivated(ctx, cl, cfg.ProtobufFeature)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return errUserTermination
+		}
+		log.Printf("[ERROR] Failed to check Protobuf activation status: %v", err)
+		return errFailure
+	}
+	var txVer byte = 2
+	if protobuf {
+		txVer = 3
+	}
+	if cfg.TxVersion != 0 {
+		if cfg.TxVersion > 2 && !protobuf {
+			log.Printf("[WARN] Protobuf transactions are not activated, node may reject transactions of version %d", cfg.TxVersion)
+		}
+		txVer = byte(cfg.TxVersion)
+		log.Printf("[INFO] Version of transactions to produce: %d (explicitly set)", txVer)
+	} else {
+		log.Printf("[INFO] Version of transactions to produce: %d", txVer)
+	}
+	if cfg.RequiredFeature > 0 {
+		activated, err := waitForFeature(ctx, cl, cfg.RequiredFeature, cfg.WaitForFeature)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return errUserTermination
+			}
+			log.Printf("[ERROR] Failed to check activation status of feature #%d: %v", cfg.RequiredFeature, err)
+			return errFailure
+		}
+		if !activated {
+			log.Printf("[ERROR] Required feature #%d is not activated", cfg.RequiredFeature)
+			return errFailure
+		}
+	}
+
+	if cfg.MustBeMiner {
+		for _, g := range generators {
+			n, err := countGeneratedBlocks(ctx, cl, g.addr, recentBlocksDepth)
+			if err != nil {
+				if errors.Is(err, context.Canceled) {
+					return errUserTermination
+				}
+				log.Printf("[ERROR] Failed to count blocks generated by '%s': %v", g.addr.String(), err)
+				return errFailure
+			}
+			log.Printf("[INFO] Generating account '%s' produced %d of last %d blocks", g.addr.String(), n, recentBlocksDepth)
+			if n == 0 {
+				gb, err := getGeneratingBalance(ctx, cl, g.addr)
+				if err != nil {
+					if errors.Is(err, context.Canceled) {
+						return errUserTermination
+					}
+					log.Printf("[ERROR] Failed to get generating balance of '%s': %v", g.addr.String(), err)
+					return errFailure
+				}
+				log.Printf("[INFO] Generating balance of generating account: %s", format(gb))
+				if gb < minGeneratingBalance {
+					log.Printf("[ERROR] Generating account '%s' produced no recent blocks and its generating balance is below %s, "+
+						"it can't mine and has no rewards to move, check the configured generating key", g.addr.String(), format(minGeneratingBalance))
+					return errFailure
+				}
+			}
+		}
+	}
+	step = stepAccounts
+	lSK, lPK, lAddr, err := loadSK(ctx, scheme, cfg.LessorSK, lessorSKProvider)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return errUserTermination
+		}
+		log.Printf("[ERROR] Failed to parse lessor private key: %v", err)
+		return errFailure
+	}
+	if differentLessorPK != nil { // Override lessor's PK and address
+		lPK = *differentLessorPK
+		lAddr, err = proto.NewAddressFromPublicKey(scheme, lPK)
+		if err != nil {
+			log.Printf("[ERROR] Failed to make lessor address from public key: %v", err)
 			return errFailure
 		}
 	}
 	log.Printf("[INFO] Lessor public key: %s", lPK.String())
 	log.Printf("[INFO] Lessor address: %s", lAddr.String())
+	transfers := false
+	for _, g := range generators {
+		if g.addr != lAddr {
+			transfers = true
+			continue
+		}
+		if cfg.Unwind {
+			continue
+		}
+		if cfg.StrictConfig {
+			log.Print("[ERROR] STRICT-CONFIG: Generating and lessor accounts must be different")
+			return errInvalidParameters
+		}
+		if len(leasingTargets) == 0 {
+			log.Print("[ERROR] Generating and lessor accounts are the same, the account can't lease to itself")
+			return errInvalidParameters
+		}
+		for _, t := range leasingTargets {
+			if t.rcp.Address != nil && *t.rcp.Address == lAddr {
+				log.Printf("[ERROR] Lessor can't lease to its own address '%s'", lAddr.String())
+				return errInvalidParameters
+			}
+		}
+		log.Print("[WARN] Generating and lessor accounts are the same, transfer is skipped and the account leases its own balance")
+	}
+	if cfg.Unwind {
+		if withdrawal == nil {
+			if len(generators) > 1 {
+				log.Print("[ERROR] Withdrawal address must be given with -withdrawal-address if there are several generating accounts")
+				return errInvalidParameters
+			}
+			rcp := proto.NewRecipientFromAddress(generators[0].addr)
+			withdrawal = &rcp
+		}
+		if withdrawal.Address != nil && *withdrawal.Address == lAddr {
+			log.Printf("[ERROR] Withdrawal address can't be the lessor's address '%s'", lAddr.String())
+			return errInvalidParameters
+		}
+		log.Printf("[INFO] Withdrawal address: %s", withdrawal.String())
+	}
+	if allowlist != nil {
+		var recipients []proto.Recipient
+		if cfg.Unwind {
+			recipients = append(recipients, *withdrawal)
+		} else {
+			if transfers {
+				recipients = append(recipients, proto.NewRecipientFromAddress(lAddr))
+			}
+			for _, t := range leasingTargets {
+				recipients = append(recipients, t.rcp)
+			}
+			if len(leasingTargets) == 0 {
+				for _, g := range generators {
+					recipients = append(recipients, proto.NewRecipientFromAddress(g.addr))
+				}
+			}
+		}
+		rcp, err := notAllowed(ctx, cl, allowlist, recipients)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return errUserTermination
+			}
+			log.Printf("[ERROR] Failed to check recipients against allowlist: %v", err)
+			return errFailure
+		}
+		if rcp != nil {
+			log.Printf("[ERROR] Recipient '%s' is not in allowlist '%s', refusing to run", rcp.String(), cfg.AllowlistFile)
+			return errInvalidParameters
+		}
+	}
+	c := &cycle{
+		cl:           cl,
+		scheme:       scheme,
+		txVer:        txVer,
+		gSK:          generators[0].sk,
+		gPK:          generators[0].pk,
+		gAddr:        generators[0].addr,
+		lSK:          lSK,
+		lPK:          lPK,
+		lAddr:        lAddr,
+		leaseTargets: leasingTargets,
+		st:           st,
+		stateFile:    cfg.StateFile,
 
-	// 4. Check available WAVES balance on generating address
-	balance, err := getAvailableWavesBalance(ctx, cl, gAddr)
+		irreducibleBalance: int64(cfg.IrreducibleBalance),
+		sponsorshipReserve: int64(cfg.SponsorshipReserve),
+		lessorFeeReserve:   int64(cfg.LessorFeeReserve),
+		balanceAlert:       int64(cfg.BalanceAlert),
+		leasingThreshold:   int64(cfg.LeasingThreshold),
+		transferPercent:    cfg.TransferPercent,
+		transferAmount:     int64(cfg.TransferAmount),
+		leaseAmount:        int64(cfg.LeaseAmount),
+		roundLease:         cfg.RoundLease,
+		rounding:           cfg.Rounding,
+		balanceSource:      cfg.BalanceSource,
+		attachment:         proto.Attachment(cfg.TransferAttachment),
+		feeAsset:           feeAsset,
+		maxAmountPerDay:    int64(cfg.MaxAmountPerDay),
+		leasedRecently:     cfg.AbortIfLeasedRecently,
+		maxFeeRatio:        cfg.MaxFeeRatio,
+		maxFee:             int64(cfg.MaxFee),
+		feeMultiplier:      cfg.FeeMultiplier,
+		leaseNoteExpiry:    cfg.LeaseNoteExpiry,
+		coalesceLeases:     cfg.CoalesceLeases,
+		skipIfActiveLease:  cfg.SkipIfActiveLease,
+		thresholdExitCode:  cfg.ThresholdExitCode,
+		broadcastRetries:   cfg.BroadcastRetries,
+		bulkBroadcast:      cfg.BulkBroadcast,
+		rawOut:             cfg.RawOut,
+		outputFile:         cfg.OutputFile,
+		rawFormat:          cfg.RawFormat,
+		dryRun:             cfg.DryRun,
+		testRun:            cfg.TestRun,
+		explorerURL:        cfg.ExplorerURL,
+		tracking:           to,
+		metrics:            m,
+		sameAccount:        generators[0].addr == lAddr,
+		checkMining:        cfg.CheckMining,
+		timestampOffset:    cfg.TimestampOffset,
+		hook:               hook,
+	}
+	if cancelID != nil {
+		step = stepCancel
+		return c.cancelLease(ctx, *cancelID)
+	}
+	if cfg.Unwind {
+		step = stepUnwind
+		return c.unwind(ctx, *withdrawal)
+	}
+	if cfg.Interval > 0 || len(generators) > 1 { // Repeated runs check the start balance each time
+		c.minStartBalance = int64(cfg.MinStartBalance)
+	}
+	cycles := []*cycle{c}
+	for _, g := range generators[1:] {
+		gc := *c
+		gc.gSK, gc.gPK, gc.gAddr = g.sk, g.pk, g.addr
+		gc.sameAccount = g.addr == lAddr
+		cycles = append(cycles, &gc)
+	}
+	step = stepRun
+	var reporter *changeReporter
+	if cfg.ReportOnlyChanged {
+		var remove func()
+		reporter, remove = installChangeReporter()
+		defer remove()
+	}
+	for i := 1; ; i++ {
+		if reporter != nil {
+			reporter.begin()
+		}
+		err = runCycles(ctx, cycles)
+		if cfg.Interval == 0 || errors.Is(err, errUserTermination) {
+			return err
+		}
+		failed := err != nil && !errors.Is(err, errBelowThreshold)
+		if failed {
+			log.Printf("[WARN] Run #%d failed, waiting for the next one", i)
+		}
+		failover := failed && len(nodeURLs) > 1
+		if cfg.MaxIterations > 0 && i >= cfg.MaxIterations {
+			if reporter != nil {
+				reporter.end(cyclesOutcome(cycles, err))
+			}
+			return err
+		}
+		log.Printf("[INFO] Next run in %s", cfg.Interval)
+		if reporter != nil {
+			reporter.end(cyclesOutcome(cycles, err))
+		}
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return errFailure
+			}
+			return errUserTermination
+		case <-time.After(cfg.Interval):
+		}
+		if failover {
+			rc, err := connectNode(ctx, nodeURLs, hc)
+			if err != nil {
+				if errors.Is(err, context.Canceled) {
+					return errUserTermination
+				}
+				log.Printf("[WARN] Failed to reconnect to node, keeping '%s': %v", c.cl.GetOptions().BaseUrl, err)
+				continue
+			}
+			if rc.GetOptions().BaseUrl != cl.GetOptions().BaseUrl {
+				log.Printf("[INFO] Switched to node at '%s'", rc.GetOptions().BaseUrl)
+			}
+			cl.Client = rc // Shared by all cycles
+		}
+	}
+}
+
+type generatorAccount struct {
+	sk   crypto.SecretKey
+	pk   crypto.PublicKey
+	addr proto.WavesAddress
+}
+
+// runCycles runs the cycles of generating accounts one after another, failure of one doesn't stop the others.
+// For several accounts errFailure is returned if any of them failed, errBelowThreshold if none failed and
+// a lease of any was below the threshold.
+func runCycles(ctx context.Context, cycles []*cycle) error {
+	errs := make([]error, len(cycles))
+	for i, c := range cycles {
+		if len(cycles) > 1 {
+			log.Printf("[INFO] Generating account %d of %d: %s", i+1, len(cycles), c.gAddr.String())
+		}
+		err := c.run(ctx)
+		if err == nil {
+			c.metrics.succeeded()
+		}
+		switch {
+		case errors.Is(err, errUserTermination):
+			return err
+		case errors.Is(err, errBelowThreshold):
+			c.hook.result(ctx, c.sum, nil)
+		default:
+			c.hook.result(ctx, c.sum, err)
+		}
+		errs[i] = err
+	}
+	if len(cycles) == 1 {
+		return errs[0]
+	}
+	sums := make([]*summary, len(cycles))
+	for i, c := range cycles {
+		sums[i] = c.sum
+	}
+	printTotals(sums, errs)
+	var r error
+	for _, err := range errs {
+		switch {
+		case err == nil:
+		case errors.Is(err, errBelowThreshold):
+			if r == nil {
+				r = err
+			}
+		default:
+			r = errFailure
+		}
+	}
+	return r
+}
+
+type cycle struct {
+	cl                 *node
+	scheme             proto.Scheme
+	txVer              byte
+	gSK                crypto.SecretKey
+	gPK                crypto.PublicKey
+	gAddr              proto.WavesAddress
+	lSK                crypto.SecretKey
+	lPK                crypto.PublicKey
+	lAddr              proto.WavesAddress
+	leaseTargets       []leaseTarget
+	st                 *state
+	stateFile          string
+	irreducibleBalance int64
+	sponsorshipReserve int64
+	lessorFeeReserve   int64
+	balanceAlert       int64
+	minStartBalance    int64
+	leasingThreshold   int64
+	transferPercent    int
+	transferAmount     int64
+	leaseAmount        int64
+	roundLease         bool
+	rounding           string
+	balanceSource      string
+	attachment         proto.Attachment
+	feeAsset           proto.OptionalAsset
+	maxAmountPerDay    int64
+	leasedRecently     time.Duration
+	maxFeeRatio        float64
+	maxFee             int64
+	feeMultiplier      float64
+	leaseNoteExpiry    time.Duration
+	coalesceLeases     bool
+	skipIfActiveLease  bool
+	thresholdExitCode  bool
+	broadcastRetries   int
+	bulkBroadcast      bool
+	rawOut             string
+	outputFile         string
+	rawFormat          string
+	dryRun             bool
+	testRun            bool
+	explorerURL        string
+	tracking           trackOptions
+	sum                *summary
+	metrics            *metrics
+	sameAccount        bool
+	checkMining        bool
+	timestampOffset    time.Duration
+	hook               *webhook
+}
+
+func (c *cycle) run(ctx context.Context) (err error) {
+	step := stepTransfer
+	defer func() { err = wrapStep(step, err) }()
+	c.sum = &summary{generator: c.gAddr, lessor: c.lAddr, dryRun: c.dryRun}
+	if c.minStartBalance > 0 {
+		ok, err := checkStartBalance(ctx, c.cl, c.gAddr, uint64(c.minStartBalance))
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return errUserTermination
+			}
+			log.Printf("[ERROR] Failed to get generator WAVES balance: %v", err)
+			return errFailure
+		}
+		if !ok {
+			return nil
+		}
+	}
+	if c.st != nil {
+		defer func() {
+			switch {
+			case c.dryRun:
+				c.diffLastRun()
+			case err == nil || errors.Is(err, errBelowThreshold):
+				c.recordRun()
+			}
+		}()
+	}
+	defer c.sum.print()
+	if c.dryRun {
+		defer c.projectBalances(ctx)
+	}
+	if c.st != nil {
+		if expired := c.st.expiredLeaseNotes(timestamp()); len(expired) > 0 {
+			leases, err := getActiveLeases(ctx, c.cl, c.lAddr)
+			if err != nil {
+				if errors.Is(err, context.Canceled) {
+					return errUserTermination
+				}
+				log.Printf("[ERROR] Failed to get active leases of lessor: %v", err)
+				return errFailure
+			}
+			active := make(map[string]bool, len(leases))
+			for _, l := range leases {
+				active[l.originID().String()] = true
+			}
+			for _, n := range expired {
+				if !active[n.ID] {
+					c.st.removeLeaseNote(n.ID)
+					continue
+				}
+				log.Printf("[WARN] Lease '%s' of %s to '%s' is past its noted expiry %s, consider cancelling it",
+					n.ID, format(n.Amount), n.Recipient, time.UnixMilli(int64(n.Expiry)).Format(time.RFC3339))
+			}
+			if err := c.saveState(); err != nil {
+				log.Printf("[ERROR] Failed to save state to file '%s': %v", c.stateFile, err)
+				return errFailure
+			}
+		}
+	}
+	if c.leasedRecently > 0 {
+		l, ts, err := findRecentLease(ctx, c.cl, c.lAddr, deduct(c.timestamp(), uint64(c.leasedRecently.Milliseconds())))
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return errUserTermination
+			}
+			log.Printf("[ERROR] Failed to check recent leases of lessor: %v", err)
+			return errFailure
+		}
+		if l != nil {
+			var age time.Duration
+			if now := c.timestamp(); now > ts {
+				age = time.Duration(now-ts) * time.Millisecond
+			}
+			log.Printf("[WARN] Lease '%s' was created %s ago, less than %s, aborting", l.originID().String(), age.Round(time.Second), c.leasedRecently)
+			return nil
+		}
+	}
+
+	resumed, err := c.resumePending(ctx)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return errUserTermination
+		}
+		log.Printf("[ERROR] Failed to resume pending transactions: %v", err)
+		return errFailure
+	}
+	switch {
+	case c.sameAccount:
+	case resumed["transfer"]:
+		log.Print("[INFO] Transfer of previous run is confirmed, no new transfer will be made")
+	default:
+		if ok, err := c.transfer(ctx); !ok {
+			return err
+		}
+	}
+	if resumed["lease"] {
+		log.Print("[INFO] Lease of previous run is confirmed, no new lease will be made")
+		return nil
+	}
+
+	// 6. Check WAVES balance on lessor's account
+	step = stepLease
+	var (
+		coalescedCount  int
+		coalescedAmount uint64
+		freedAmount     uint64
+	)
+	if c.coalesceLeases {
+		leases, err := getActiveLeases(ctx, c.cl, c.lAddr)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return errUserTermination
+			}
+			log.Printf("[ERROR] Failed to get active leases of lessor: %v", err)
+			return errFailure
+		}
+		coalescedCount = len(leases)
+		coalescedAmount, err = totalLeased(leases)
+		if err != nil {
+			log.Printf("[ERROR] Invalid total of active leases: %v", err)
+			return errFailure
+		}
+		log.Printf("[INFO] Lessor has %d active leases of total %s", coalescedCount, format(coalescedAmount))
+		if len(leases) > 0 {
+			cancelExtraFee, err := getExtraFee(ctx, c.cl, c.lAddr)
+			if err != nil {
+				if errors.Is(err, context.Canceled) {
+					return errUserTermination
+				}
+				log.Printf("[ERROR] Failed to check extra fee on account '%s': %v", c.lAddr.String(), err)
+				return errFailure
+			}
+			cancelFee, err := addAmounts(standardFee, cancelExtraFee)
+			if err != nil {
+				log.Printf("[ERROR] Invalid lease cancel fee: %v", err)
+				return errFailure
+			}
+			freed, err := c.cancelLeases(ctx, leases, cancelFee)
+			if err != nil {
+				return err
+			}
+			if c.dryRun { // Balance is not affected by cancels in dry-run, so add the amount they would free
+				freedAmount = freed
+			}
+		}
+	}
+	balance, err := getWavesBalance(ctx, c.cl, c.lAddr, c.balanceSource)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return errUserTermination
+		}
+		log.Printf("[ERROR] Failed to get lessor account's WAVES balance: %v", err)
+		return errFailure
+	}
+	if freedAmount > 0 {
+		log.Printf("[INFO] DRY-RUN: Balance of lessor account would increase by %s after cancelling leases", format(freedAmount))
+		balance, err = addAmounts(balance, freedAmount)
+		if err != nil {
+			log.Printf("[ERROR] Invalid lessor's balance: %v", err)
+			return errFailure
+		}
+	}
+	logWith(fields{"address": c.lAddr.String(), "amount": balance},
+		"[INFO] Balance of lessor account '%s': %s", c.lAddr.String(), format(balance))
+	if c.irreducibleBalance > 0 {
+		b := deduct(balance, uint64(c.irreducibleBalance))
+		if b > 0 {
+			explainf("Lessor's available balance %s minus irreducible balance %s leaves %s",
+				format(balance), format(uint64(c.irreducibleBalance)), format(b))
+		} else {
+			explainf("Lessor's available balance %s is covered by irreducible balance %s, nothing is left",
+				format(balance), format(uint64(c.irreducibleBalance)))
+			log.Printf("[INFO] Lessor's balance %s is fully covered by irreducible balance %s, nothing to lease",
+				format(balance), format(uint64(c.irreducibleBalance)))
+			return nil
+		}
+		balance = b
+	}
+	if c.sponsorshipReserve > 0 {
+		log.Printf("[INFO] Reserved for sponsorship on lessor's account: %s", format(uint64(c.sponsorshipReserve)))
+		b := deduct(balance, uint64(c.sponsorshipReserve))
+		if b > 0 {
+			explainf("Lessor's balance %s minus sponsorship reserve %s leaves %s",
+				format(balance), format(uint64(c.sponsorshipReserve)), format(b))
+		} else {
+			explainf("Lessor's balance %s is covered by sponsorship reserve %s, nothing is left",
+				format(balance), format(uint64(c.sponsorshipReserve)))
+		}
+		balance = b
+	}
+	if c.lessorFeeReserve > 0 {
+		log.Printf("[INFO] Reserved for fees on lessor's account: %s", format(uint64(c.lessorFeeReserve)))
+		b := deduct(balance, uint64(c.lessorFeeReserve))
+		if b > 0 {
+			explainf("Lessor's balance %s minus fee reserve %s leaves %s",
+				format(balance), format(uint64(c.lessorFeeReserve)), format(b))
+		} else {
+			explainf("Lessor's balance %s is covered by fee reserve %s, nothing is left",
+				format(balance), format(uint64(c.lessorFeeReserve)))
+		}
+		balance = b
+	}
+	if balance <= standardFee {
+		explainf("Lessor's balance %s does not exceed standard fee %s", format(balance), format(standardFee))
+		log.Print("[ERROR] Not enough balance on lessor's account")
+		return errFailure
+	}
+	if balance > waves && c.testRun {
+		explainf("Lessor's balance %s is limited to %s by test run", format(balance), format(waves))
+		balance = waves
+	}
+	log.Printf("[INFO] Balance available for leasing: %s", format(balance))
+
+	// 7. Create leasing transactions to generating account or leasing addresses
+	targets := c.leaseTargets
+	if len(targets) == 0 {
+		targets = []leaseTarget{{rcp: proto.NewRecipientFromAddress(c.gAddr), weight: 1}}
+	}
+	for _, t := range targets {
+		if len(targets) > 1 {
+			log.Printf("[INFO] Leasing to address: %s, weight %d", t.rcp.String(), t.weight)
+		} else {
+			log.Printf("[INFO] Leasing to address: %s", t.rcp.String())
+		}
+	}
+	leases, err := listActiveLeases(ctx, c.cl, c.lAddr)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return errUserTermination
+		}
+		log.Printf("[ERROR] Failed to get active leases of lessor: %v", err)
+		return errFailure
+	}
+	if c.skipIfActiveLease {
+		remaining := make([]leaseTarget, 0, len(targets))
+		for _, t := range targets {
+			if l := findActiveLease(leases, t.rcp, uint64(c.leasingThreshold)); l != nil {
+				log.Printf("[INFO] Lessor already has active lease '%s' of %s to '%s', no lease will be made to it",
+					l.ID.String(), format(l.Amount), t.rcp.String())
+				continue
+			}
+			remaining = append(remaining, t)
+		}
+		if len(remaining) == 0 {
+			return nil
+		}
+		targets = remaining
+	}
+	leaseExtraFee, err := getExtraFee(ctx, c.cl, c.lAddr)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return errUserTermination
+		}
+		log.Printf("[ERROR] Failed to check extra fee on account '%s': %v", c.lAddr.String(), err)
+		return errFailure
+	}
+	if leaseExtraFee != 0 {
+		log.Printf("[INFO] Extra fee on lease: %s", format(leaseExtraFee))
+	} else {
+		log.Print("[INFO] No extra fee on lease")
+	}
+	fee, err := addAmounts(standardFee, leaseExtraFee)
+	if err != nil {
+		log.Printf("[ERROR] Invalid lease fee: %v", err)
+		return errFailure
+	}
+	explainf("Lease fee is standard fee %s plus extra fee %s, total %s", format(standardFee), format(leaseExtraFee), format(fee))
+	fee, err = c.fee(ctx, proto.NewUnsignedLeaseWithProofs(c.txVer, c.lPK, targets[0].rcp, balance, fee, c.timestamp()), fee, "lease")
 	if err != nil {
 		if errors.Is(err, context.Canceled) {
 			return errUserTermination
 		}
+		log.Printf("[ERROR] Invalid lease fee: %v", err)
+		return errFailure
+	}
+	fees := fee
+	for i := 1; i < len(targets); i++ {
+		fees, err = addAmounts(fees, fee)
+		if err != nil {
+			log.Printf("[ERROR] Invalid lease fees: %v", err)
+			return errFailure
+		}
+	}
+	if len(targets) > 1 {
+		explainf("Fees of %d leases are %s", len(targets), format(fees))
+	}
+	if balance <= fees {
+		explainf("Lessor's balance %s does not exceed lease fees %s", format(balance), format(fees))
+		log.Printf("[ERROR] Lessor's balance %s is not enough to pay lease fees %s and lease anything", format(balance), format(fees))
+		return errFailure
+	}
+	amount, err := subAmounts(balance, fees)
+	if err != nil {
+		log.Printf("[ERROR] Invalid lease amount: %v", err)
+		return errFailure
+	}
+	explainf("Lease amount is balance %s minus fee %s, total %s", format(balance), format(fees), format(amount))
+	if c.leaseAmount > 0 {
+		if amount < uint64(c.leaseAmount) {
+			explainf("Lessor's balance %s minus fees %s is less than lease amount %s", format(balance), format(fees), format(uint64(c.leaseAmount)))
+			log.Printf("[ERROR] Lessor's balance %s is not enough to lease %s and pay fees %s",
+				format(balance), format(uint64(c.leaseAmount)), format(fees))
+			return errFailure
+		}
+		explainf("Lease amount is fixed to %s", format(uint64(c.leaseAmount)))
+		amount = uint64(c.leaseAmount)
+	}
+	if c.maxAmountPerDay > 0 {
+		budget := c.st.dailyBudget("lease", uint64(c.maxAmountPerDay))
+		log.Printf("[INFO] Remaining daily budget of leases: %s", format(budget))
+		if budget == 0 {
+			log.Print("[INFO] Daily amount limit is exhausted, no lease will be made")
+			return nil
+		}
+		if c.leaseAmount > 0 && amount > budget {
+			log.Printf("[INFO] Lease amount %s exceeds remaining daily budget, no lease will be made", format(amount))
+			return nil
+		}
+		if amount > budget {
+			log.Printf("[INFO] Lease amount %s is limited to remaining daily budget", format(amount))
+			explainf("Lease amount %s exceeds remaining daily budget %s, so it is reduced", format(amount), format(budget))
+			amount = budget
+		}
+	}
+	shares, rem, err := splitAmount(amount, targets, c.rounding)
+	if err != nil {
+		log.Printf("[ERROR] Failed to split lease amount: %v", err)
+		return errFailure
+	}
+	if rem > 0 {
+		if c.rounding == roundingDrop {
+			log.Printf("[INFO] Remainder %s of splitting lease amount stays on lessor's account", format(rem))
+		} else {
+			to := map[string]string{
+				roundingFirst:   "the first leasing address",
+				roundingLast:    "the last leasing address",
+				roundingLargest: "the leasing address with the largest weight",
+			}[c.rounding]
+			log.Printf("[INFO] Remainder %s of splitting lease amount goes to %s", format(rem), to)
+		}
+	}
+	// Shares that can't be leased are skipped and stay on lessor's account, the rest are leased
+	var (
+		leaseTargets   = make([]leaseTarget, 0, len(targets))
+		leaseShares    = make([]uint64, 0, len(shares))
+		leased         uint64 // Shares sum up to the amount, so no overflow
+		belowThreshold bool
+	)
+	for i, share := range shares {
+		if len(targets) > 1 {
+			explainf("Share of '%s' with weight %d is %s", targets[i].rcp.String(), targets[i].weight, format(share))
+		}
+		if c.roundLease {
+			r := share - share%waves
+			explainf("Lease amount %s rounded down to whole WAVES is %s, %s stays on lessor's account",
+				format(share), format(r), format(share-r))
+			if r == 0 {
+				log.Printf("[INFO] Lease amount %s to '%s' is less than 1 WAVES, nothing to lease after rounding",
+					format(share), targets[i].rcp.String())
+				continue
+			}
+			shares[i], share = r, r
+		}
+		if c.leasingThreshold > 0 {
+			if share < uint64(c.leasingThreshold) {
+				explainf("Lease amount %s is less than threshold %s, so no lease is created", format(share), format(uint64(c.leasingThreshold)))
+				log.Printf("[INFO] Leasing amount %d to '%s' is less than threshold %d", share, targets[i].rcp.String(), c.leasingThreshold)
+				belowThreshold = true
+				continue
+			}
+			explainf("Lease amount %s reaches threshold %s, so lease is created", format(share), format(uint64(c.leasingThreshold)))
+		} else {
+			explainf("No leasing threshold is set, so lease is created for any positive amount")
+		}
+		if share == 0 {
+			log.Printf("[ERROR] Zero amount to lease to '%s'", targets[i].rcp.String())
+			return errFailure
+		}
+		if c.maxFeeRatio > 0 {
+			log.Printf("[INFO] Lease fee ratio %.4f, maximum %.4f", feeRatio(fee, share), c.maxFeeRatio)
+		}
+		if c.maxFeeRatio > 0 && feeRatio(fee, share) > c.maxFeeRatio {
+			log.Printf("[WARN] Lease fee ratio exceeds maximum, skipping lease to '%s'", targets[i].rcp.String())
+			continue
+		}
+		leaseTargets = append(leaseTargets, targets[i])
+		leaseShares = append(leaseShares, share)
+		leased += share
+	}
+	if len(leaseTargets) == 0 {
+		if belowThreshold && c.thresholdExitCode {
+			return errBelowThreshold
+		}
+		return nil
+	}
+	if len(leaseTargets) < len(targets) {
+		log.Printf("[INFO] %d of %d shares are skipped and stay on lessor's account", len(targets)-len(leaseTargets), len(targets))
+	}
+	targets, shares = leaseTargets, leaseShares
+	for i, t := range targets {
+		if err := c.reportMiningEligibility(ctx, t.rcp, shares[i]); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return errUserTermination
+			}
+			log.Printf("[WARN] Failed to check generating balance of '%s': %v", t.rcp.String(), err)
+		}
+	}
+	if c.checkMining {
+		recipients := make([]proto.Recipient, len(targets))
+		for i, t := range targets {
+			recipients[i] = t.rcp
+		}
+		if err := c.reportRecentMining(ctx, recipients); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return errUserTermination
+			}
+			log.Printf("[WARN] Failed to check recent blocks of leasing addresses: %v", err)
+		}
+	}
+	if c.bulkBroadcast && !c.dryRun && len(targets) > 1 {
+		if err := c.leaseBulk(ctx, targets, shares, fee); err != nil {
+			return err
+		}
+	} else {
+		for i, t := range targets {
+			if err := c.lease(ctx, t.rcp, shares[i], fee); err != nil {
+				return err
+			}
+		}
+	}
+	if c.coalesceLeases {
+		log.Printf("[INFO] Leases coalesced: %d leases of total %s before, %d leases of total %s after",
+			coalescedCount, format(coalescedAmount), len(targets), format(leased))
+	}
+	logWith(fields{"status": "ok"}, "[INFO] OK")
+	return nil
+}
+
+func (c *cycle) transfer(ctx context.Context) (bool, error) {
+	// 4. Check available WAVES balance on generating address
+	balance, err := getWavesBalance(ctx, c.cl, c.gAddr, c.balanceSource)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return false, errUserTermination
+		}
 		log.Printf("[ERROR] Failed to get generator WAVES balance: %v", err)
+		return false, errFailure
+	}
+	logWith(fields{"address": c.gAddr.String(), "amount": balance},
+		"[INFO] Balance of generation account '%s': %s", c.gAddr.String(), format(balance))
+	b := deduct(balance, uint64(c.irreducibleBalance))
+	if c.balanceAlert > 0 && b < uint64(c.balanceAlert) { // Before the return below, fully covered balance is the lowest one
+		log.Printf("[WARN] Generator's balance %s is below alert threshold %s", format(b), format(uint64(c.balanceAlert)))
+		c.hook.alert(ctx, fmt.Sprintf("balance %s of generator '%s' is below alert threshold %s",
+			format(b), c.gAddr.String(), format(uint64(c.balanceAlert))))
+	}
+	if c.irreducibleBalance > 0 {
+		if b > 0 {
+			explainf("Generator's available balance %s minus irreducible balance %s leaves %s",
+				format(balance), format(uint64(c.irreducibleBalance)), format(b))
+		} else {
+			explainf("Generator's available balance %s is covered by irreducible balance %s, nothing is left",
+				format(balance), format(uint64(c.irreducibleBalance)))
+			log.Printf("[INFO] Generator's balance %s is fully covered by irreducible balance %s, nothing to transfer",
+				format(balance), format(uint64(c.irreducibleBalance)))
+			return false, nil
+		}
+		balance = b
+	}
+	if balance <= standardFee {
+		explainf("Generator's balance %s does not exceed standard fee %s", format(balance), format(standardFee))
+		log.Print("[ERROR] Not enough balance on generator's account")
+		return false, errFailure
+	}
+	if balance > waves && c.testRun {
+		explainf("Generator's balance %s is limited to %s by test run", format(balance), format(waves))
+		balance = waves
+	}
+	if c.transferPercent < 100 {
+		b := percentOf(balance, c.transferPercent)
+		explainf("%d%% of generator's balance %s is %s", c.transferPercent, format(balance), format(b))
+		balance = b
+	}
+	log.Printf("[INFO] Balance available for transfer: %s", format(balance))
+
+	// 5. Create transfer transaction to lessor account
+	rcp := proto.NewRecipientFromAddress(c.lAddr)
+	transferExtraFee, err := getExtraFee(ctx, c.cl, c.gAddr)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return false, errUserTermination
+		}
+		log.Printf("[ERROR] Failed to check extra fee on account '%s': %v", c.lAddr.String(), err)
+		return false, errFailure
+	}
+	if transferExtraFee != 0 {
+		log.Printf("[INFO] Extra fee on transfer: %s", format(transferExtraFee))
+	} else {
+		log.Print("[INFO] No extra fee on transfer")
+	}
+	fee, err := addAmounts(standardFee, transferExtraFee)
+	if err != nil {
+		log.Printf("[ERROR] Invalid transfer fee: %v", err)
+		return false, errFailure
+	}
+	explainf("Transfer fee is standard fee %s plus extra fee %s, total %s", format(standardFee), format(transferExtraFee), format(fee))
+	fee, err = c.fee(ctx, proto.NewUnsignedTransferWithProofs(c.txVer, c.gPK, na, na, c.timestamp(), balance, fee, rcp, c.attachment), fee, "transfer")
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return false, errUserTermination
+		}
+		log.Printf("[ERROR] Invalid transfer fee: %v", err)
+		return false, errFailure
+	}
+	txFee, ratioFee := fee, fee
+	if c.feeAsset.Present {
+		txFee, err = c.assetFee(ctx, fee)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return false, errUserTermination
+			}
+			log.Printf("[ERROR] Failed to pay transfer fee in asset: %v", err)
+			return false, errFailure
+		}
+		fee = 0 // Fee is not deducted from WAVES balance
+	}
+	if balance <= fee {
+		explainf("Generator's balance %s does not exceed transfer fee %s", format(balance), format(fee))
+		log.Printf("[ERROR] Generator's balance %s is not enough to pay transfer fee %s and transfer anything", format(balance), format(fee))
+		return false, errFailure
+	}
+	amount, err := subAmounts(balance, fee)
+	if err != nil {
+		log.Printf("[ERROR] Invalid transfer amount: %v", err)
+		return false, errFailure
+	}
+	explainf("Transfer amount is balance %s minus fee %s, total %s", format(balance), format(fee), format(amount))
+	if c.transferAmount > 0 {
+		if amount < uint64(c.transferAmount) {
+			explainf("Generator's balance %s minus fee %s is less than transfer amount %s", format(balance), format(fee), format(uint64(c.transferAmount)))
+			log.Printf("[ERROR] Generator's balance %s is not enough to transfer %s and pay fee %s",
+				format(balance), format(uint64(c.transferAmount)), format(fee))
+			return false, errFailure
+		}
+		explainf("Transfer amount is fixed to %s", format(uint64(c.transferAmount)))
+		amount = uint64(c.transferAmount)
+	}
+	if c.maxAmountPerDay > 0 {
+		budget := c.st.dailyBudget("transfer", uint64(c.maxAmountPerDay))
+		log.Printf("[INFO] Remaining daily budget of transfers: %s", format(budget))
+		if budget == 0 {
+			log.Print("[INFO] Daily amount limit is exhausted, no transfer will be made")
+			return false, nil
+		}
+		if c.transferAmount > 0 && amount > budget {
+			log.Printf("[INFO] Transfer amount %s exceeds remaining daily budget, no transfer will be made", format(amount))
+			return false, nil
+		}
+		if amount > budget {
+			log.Printf("[INFO] Transfer amount %s is limited to remaining daily budget", format(amount))
+			explainf("Transfer amount %s exceeds remaining daily budget %s, so it is reduced", format(amount), format(budget))
+			amount = budget
+		}
+	}
+	if c.maxFeeRatio > 0 {
+		log.Printf("[INFO] Transfer fee ratio %.4f, maximum %.4f", feeRatio(ratioFee, amount), c.maxFeeRatio)
+	}
+	if c.maxFeeRatio > 0 && feeRatio(ratioFee, amount) > c.maxFeeRatio {
+		log.Print("[WARN] Transfer fee ratio exceeds maximum, skipping transfer")
+	} else {
+		transfer := proto.NewUnsignedTransferWithProofs(c.txVer, c.gPK, na, c.feeAsset, c.timestamp(), amount, txFee, rcp, c.attachment)
+		err = transfer.Sign(c.scheme, c.gSK)
+		if err != nil {
+			log.Printf("[ERROR] Failed to sign transfer transaction: %v", err)
+			return false, errFailure
+		}
+		if c.dryRun {
+			b, err := json.Marshal(transfer)
+			if err != nil {
+				log.Printf("[ERROR] Failed to make transaction json: %v", err)
+				return false, errFailure
+			}
+			log.Printf("[INFO] Transfer transaction:\n%s", string(b))
+			logWith(fields{"txId": transfer.ID.String(), "amount": amount, "fee": txFee, "address": c.lAddr.String()},
+				"[INFO] DRY-RUN: Transfer transaction ID: %s", transfer.ID.String())
+			if err := c.writeOut(transfer); err != nil {
+				log.Printf("[ERROR] Failed to write transfer transaction: %v", err)
+				return false, errFailure
+			}
+			c.sum.transfer(transfer.ID.String(), amount, fee)
+		} else {
+			logWith(fields{"txId": transfer.ID.String(), "amount": amount, "fee": txFee, "address": c.lAddr.String()},
+				"[INFO] Transfer transaction ID: %s", transfer.ID.String())
+			if c.explorerURL != "" {
+				log.Printf("[INFO] Transfer transaction in explorer: %s", explorerLink(c.explorerURL, *transfer.ID))
+			}
+			lessorBalance, err := getAvailableWavesBalance(ctx, c.cl, c.lAddr)
+			if err != nil {
+				if errors.Is(err, context.Canceled) {
+					return false, errUserTermination
+				}
+				log.Printf("[ERROR] Failed to get lessor account's WAVES balance: %v", err)
+				return false, errFailure
+			}
+			if c.st != nil { // Saved before broadcasting, so the transaction is resumed by the next run if this one crashes
+				c.st.addSpending("transfer", transfer.ID.String(), amount)
+				c.st.addPending("transfer", transfer.ID.String(), c.gAddr.String(), balance, amount)
+				if err := c.saveState(); err != nil {
+					log.Printf("[ERROR] Failed to save state to file '%s': %v", c.stateFile, err)
+					return false, errFailure
+				}
+			}
+			err = broadcast(ctx, c.cl, transfer, c.broadcastRetries)
+			if err != nil {
+				if errors.Is(err, context.Canceled) || errors.Is(err, errUserTermination) {
+					return false, errUserTermination
+				}
+				log.Printf("[ERROR] Failed to broadcast transfer transaction: %v", err)
+				c.metrics.transferFailed()
+				return false, failure(err)
+			}
+			c.sum.transfer(transfer.ID.String(), amount, fee)
+			err = track(ctx, c.cl, *transfer.ID, c.tracking)
+			if err != nil {
+				if errors.Is(err, context.Canceled) {
+					return false, errUserTermination
+				}
+				log.Printf("[ERROR] Failed to track transfer transaction: %v", err)
+				c.metrics.transferFailed()
+				return false, failure(err)
+			}
+			c.metrics.transferred(amount)
+			if err := c.confirmPending(transfer.ID.String()); err != nil {
+				log.Printf("[ERROR] Failed to save state to file '%s': %v", c.stateFile, err)
+				return false, errFailure
+			}
+			err = waitCredited(ctx, c.cl, c.lAddr, lessorBalance, amount, c.tracking)
+			if err != nil {
+				if errors.Is(err, context.Canceled) {
+					return false, errUserTermination
+				}
+				log.Printf("[ERROR] Failed to check lessor's balance after transfer: %v", err)
+				return false, errFailure
+			}
+		}
+	}
+	return true, nil
+}
+
+// cancelLeases cancels the leases of lessor with the fee estimated from the given one and returns the amount
+// the cancels free on lessor's account, that is total of the leases minus the fees. In dry-run the cancels are only
+// logged, otherwise the freed amount is waited to appear on lessor's balance.
+func (c *cycle) cancelLeases(ctx context.Context, leases []activeLease, fee uint64) (uint64, error) {
+	if len(leases) == 0 {
+		return 0, nil
+	}
+	leased, err := totalLeased(leases)
+	if err != nil {
+		log.Printf("[ERROR] Invalid total of active leases: %v", err)
+		return 0, errFailure
+	}
+	fee, err = c.fee(ctx, proto.NewUnsignedLeaseCancelWithProofs(c.txVer, c.scheme, c.lPK, leases[0].ID, fee, c.timestamp()), fee, "lease cancel")
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return 0, errUserTermination
+		}
+		log.Printf("[ERROR] Invalid lease cancel fee: %v", err)
+		return 0, errFailure
+	}
+	var fees uint64
+	for range leases {
+		fees, err = addAmounts(fees, fee)
+		if err != nil {
+			log.Printf("[ERROR] Invalid lease cancel fees: %v", err)
+			return 0, errFailure
+		}
+	}
+	available, err := getAvailableWavesBalance(ctx, c.cl, c.lAddr)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return 0, errUserTermination
+		}
+		log.Printf("[ERROR] Failed to get lessor account's WAVES balance: %v", err)
+		return 0, errFailure
+	}
+	if available < fees {
+		log.Printf("[ERROR] Not enough balance on lessor's account to pay %s of fees for cancelling leases", format(fees))
+		return 0, errFailure
+	}
+	for _, l := range leases {
+		cancel, err := newLeaseCancel(c.scheme, c.txVer, c.lSK, c.lPK, l.ID, fee, c.timestamp())
+		if err != nil {
+			log.Printf("[ERROR] Failed to sign lease cancel transaction: %v", err)
+			return 0, errFailure
+		}
+		if c.dryRun {
+			logWith(fields{"txId": cancel.ID.String(), "amount": l.Amount, "fee": fee, "address": l.Recipient.String()},
+				"[INFO] DRY-RUN: Lease '%s' of %s to '%s' would be cancelled by transaction '%s'",
+				l.ID.String(), format(l.Amount), l.Recipient.String(), cancel.ID.String())
+			if err := c.writeOut(cancel); err != nil {
+				log.Printf("[ERROR] Failed to write lease cancel transaction: %v", err)
+				return 0, errFailure
+			}
+			c.sum.cancel(cancel.ID.String(), l.Recipient, l.Amount, fee)
+			continue
+		}
+		logWith(fields{"txId": cancel.ID.String(), "amount": l.Amount, "fee": fee, "address": l.Recipient.String()},
+			"[INFO] Cancelling lease '%s' of %s to '%s' by transaction '%s'",
+			l.ID.String(), format(l.Amount), l.Recipient.String(), cancel.ID.String())
+		if c.explorerURL != "" {
+			log.Printf("[INFO] Lease cancel transaction in explorer: %s", explorerLink(c.explorerURL, *cancel.ID))
+		}
+		err = broadcast(ctx, c.cl, cancel, c.broadcastRetries)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, errUserTermination) {
+				return 0, errUserTermination
+			}
+			log.Printf("[ERROR] Failed to broadcast lease cancel transaction: %v", err)
+			return 0, errFailure
+		}
+		c.sum.cancel(cancel.ID.String(), l.Recipient, l.Amount, fee)
+		if c.st != nil {
+			c.st.removeLeaseNote(l.originID().String())
+			if err := c.saveState(); err != nil {
+				log.Printf("[ERROR] Failed to save state to file '%s': %v", c.stateFile, err)
+				return 0, errFailure
+			}
+		}
+		err = track(ctx, c.cl, *cancel.ID, c.tracking)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return 0, errUserTermination
+			}
+			log.Printf("[ERROR] Failed to track lease cancel transaction: %v", err)
+			return 0, errFailure
+		}
+	}
+	freed := deduct(leased, fees)
+	if !c.dryRun {
+		if err := waitCredited(ctx, c.cl, c.lAddr, deduct(available, fees), leased, c.tracking); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return 0, errUserTermination
+			}
+			log.Printf("[ERROR] Failed to check lessor's balance after cancelling leases: %v", err)
+			return 0, errFailure
+		}
+	}
+	return freed, nil
+}
+
+func (c *cycle) lease(ctx context.Context, rcp proto.Recipient, amount, fee uint64) error {
+	lease, err := c.prepareLease(rcp, amount, fee)
+	if err != nil || lease == nil {
+		return err
+	}
+	err = broadcast(ctx, c.cl, lease, c.broadcastRetries)
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, errUserTermination) {
+			return errUserTermination
+		}
+		log.Printf("[ERROR] Failed to broadcast lease transaction: %v", err)
+		c.metrics.leaseFailed()
+		return failure(err)
+	}
+	return c.confirmLease(ctx, lease)
+}
+
+// leaseBulk creates the leases of shares to targets and broadcasts them in one request.
+func (c *cycle) leaseBulk(ctx context.Context, targets []leaseTarget, shares []uint64, fee uint64) error {
+	leases := make([]*proto.LeaseWithProofs, len(targets))
+	txs := make([]proto.Transaction, len(targets))
+	for i, t := range targets {
+		lease, err := c.prepareLease(t.rcp, shares[i], fee)
+		if err != nil {
+			return err
+		}
+		leases[i], txs[i] = lease, lease
+	}
+	log.Printf("[INFO] Broadcasting %d lease transactions in one request", len(txs))
+	err := broadcastBulk(ctx, c.cl, txs, c.broadcastRetries)
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, errUserTermination) {
+			return errUserTermination
+		}
+		log.Printf("[ERROR] Failed to broadcast lease transactions: %v", err)
+		c.metrics.leaseFailed()
+		return failure(err)
+	}
+	for _, lease := range leases {
+		if err := c.confirmLease(ctx, lease); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareLease signs the lease transaction and saves it as pending before broadcasting.
+// In dry-run the transaction is only written out and nil is returned.
+func (c *cycle) prepareLease(rcp proto.Recipient, amount, fee uint64) (*proto.LeaseWithProofs, error) {
+	lease := proto.NewUnsignedLeaseWithProofs(c.txVer, c.lPK, rcp, amount, fee, c.timestamp())
+	err := lease.Sign(c.scheme, c.lSK)
+	if err != nil {
+		log.Printf("[ERROR] Failed to sign lease transaction: %v", err)
+		return nil, errFailure
+	}
+	if c.dryRun {
+		b, err := json.Marshal(lease)
+		if err != nil {
+			log.Printf("[ERROR] Failed to make transaction json: %v", err)
+			return nil, errFailure
+		}
+		log.Printf("[INFO] Lease transaction:\n%s", string(b))
+		logWith(fields{"txId": lease.ID.String(), "amount": amount, "fee": fee, "address": rcp.String()},
+			"[INFO] DRY-RUN: Lease transaction ID: %s", lease.ID.String())
+		if err := c.writeOut(lease); err != nil {
+			log.Printf("[ERROR] Failed to write lease transaction: %v", err)
+			return nil, errFailure
+		}
+		c.sum.lease(lease.ID.String(), rcp, amount, fee)
+		return nil, nil
+	}
+	logWith(fields{"txId": lease.ID.String(), "amount": amount, "fee": fee, "address": rcp.String()},
+		"[INFO] Lease transaction ID: %s", lease.ID.String())
+	if c.explorerURL != "" {
+		log.Printf("[INFO] Lease transaction in explorer: %s", explorerLink(c.explorerURL, *lease.ID))
+	}
+	if c.st != nil { // Saved before broadcasting, so the transaction is resumed by the next run if this one crashes
+		c.st.addSpending("lease", lease.ID.String(), amount)
+		c.st.addPending("lease", lease.ID.String(), c.lAddr.String(), 0, amount)
+		if c.leaseNoteExpiry > 0 {
+			c.st.addLeaseNote(lease.ID.String(), rcp.String(), amount, c.leaseNoteExpiry)
+			log.Printf("[INFO] Lease is noted to expire in %s", c.leaseNoteExpiry)
+		}
+		if err := c.saveState(); err != nil {
+			log.Printf("[ERROR] Failed to save state to file '%s': %v", c.stateFile, err)
+			return nil, errFailure
+		}
+	}
+	return lease, nil
+}
+
+// confirmLease tracks the broadcasted lease transaction until it is confirmed.
+func (c *cycle) confirmLease(ctx context.Context, lease *proto.LeaseWithProofs) error {
+	c.sum.lease(lease.ID.String(), lease.Recipient, lease.Amount, lease.Fee)
+	err := track(ctx, c.cl, *lease.ID, c.tracking)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return errUserTermination
+		}
+		log.Printf("[ERROR] Failed to track lease transaction: %v", err)
+		c.metrics.leaseFailed()
+		return failure(err)
+	}
+	c.metrics.leased(lease.Amount)
+	if err := c.confirmPending(lease.ID.String()); err != nil {
+		log.Printf("[ERROR] Failed to save state to file '%s': %v", c.stateFile, err)
+		return errFailure
+	}
+	return nil
+}
+
+// writeOut writes the transaction that is not broadcasted to raw output file and to signed transactions file.
+func (c *cycle) writeOut(tx proto.Transaction) error {
+	if c.rawOut != "" {
+		if err := writeRaw(c.rawOut, c.rawFormat, c.scheme, tx); err != nil {
+			return err
+		}
+	}
+	if c.outputFile != "" {
+		if err := writeSigned(c.outputFile, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *cycle) cancelLease(ctx context.Context, id crypto.Digest) error {
+	leases, err := getActiveLeases(ctx, c.cl, c.lAddr)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return errUserTermination
+		}
+		log.Printf("[ERROR] Failed to get active leases of lessor: %v", err)
 		return errFailure
 	}
-	log.Printf("[INFO] Balance of generation account '%s': %s", gAddr.String(), format(balance))
-	if irreducibleBalance > 0 {
-		b := int64(balance) - irreducibleBalance
-		if b > 0 {
-			balance = uint64(b)
-		} else {
-			balance = 0
+	var lease *activeLease
+	for i := range leases {
+		if leases[i].ID == id {
+			lease = &leases[i]
+			break
 		}
 	}
-	if balance <= standardFee {
-		log.Print("[ERROR] Not enough balance on generator's account")
+	if lease == nil {
+		log.Printf("[ERROR] Lease '%s' is not an active lease of lessor '%s'", id.String(), c.lAddr.String())
 		return errFailure
 	}
-	if balance > waves && testRun {
-		balance = waves
-	}
-	log.Printf("[INFO] Balance available for transfer: %s", format(balance))
-
-	// 5. Create transfer transaction to lessor account
-	rcp := proto.NewRecipientFromAddress(lAddr)
-	transferExtraFee, err := getExtraFee(ctx, cl, gAddr)
+	extraFee, err := getExtraFee(ctx, c.cl, c.lAddr)
 	if err != nil {
 		if errors.Is(err, context.Canceled) {
 			return errUserTermination
 		}
-		log.Printf("[ERROR] Failed to check extra fee on account '%s': %v", lAddr.String(), err)
-		return errFailure
-	}
-	if transferExtraFee != 0 {
-		log.Printf("[INFO] Extra fee on transfer: %s", format(transferExtraFee))
-	} else {
-		log.Print("[INFO] No extra fee on transfer")
-	}
-	fee := standardFee + transferExtraFee
-	amount := balance - fee
-	if amount <= 0 {
-		log.Print("[ERROR] Negative of zero amount to transfer")
+		log.Printf("[ERROR] Failed to check extra fee on account '%s': %v", c.lAddr.String(), err)
 		return errFailure
 	}
-	transfer := proto.NewUnsignedTransferWithProofs(txVer, gPK, na, na, timestamp(), amount, fee, rcp, nil)
-	err = transfer.Sign(scheme, gSK)
+	fee, err := addAmounts(standardFee, extraFee)
 	if err != nil {
-		log.Printf("[ERROR] Failed to sign transfer transaction: %v", err)
+		log.Printf("[ERROR] Invalid lease cancel fee: %v", err)
 		return errFailure
 	}
-	if dryRun {
-		b, err := json.Marshal(transfer)
-		if err != nil {
-			log.Printf("[ERROR] Failed to make transaction json: %v", err)
-			return errFailure
-		}
-		log.Printf("[INFO] Transfer transaction:\n%s", string(b))
-	} else {
-		log.Printf("[INFO] Transfer transaction ID: %s", transfer.ID.String())
-		err = broadcast(ctx, cl, transfer)
-		if err != nil {
-			if errors.Is(err, context.Canceled) {
-				return errUserTermination
-			}
-			log.Printf("[ERROR] Failed to broadcast transfer transaction: %v", err)
-			return errFailure
-		}
-		err = track(ctx, cl, *transfer.ID)
-		if err != nil {
-			if errors.Is(err, context.Canceled) {
-				return errUserTermination
-			}
-			log.Printf("[ERROR] Failed to track transfer transaction: %v", err)
-			return errFailure
+	fee, err = c.fee(ctx, proto.NewUnsignedLeaseCancelWithProofs(c.txVer, c.scheme, c.lPK, lease.ID, fee, c.timestamp()), fee, "lease cancel")
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return errUserTermination
 		}
+		log.Printf("[ERROR] Invalid lease cancel fee: %v", err)
+		return errFailure
 	}
-
-	// 6. Check WAVES balance on lessor's account
-	balance, err = getAvailableWavesBalance(ctx, cl, lAddr)
+	balance, err := getAvailableWavesBalance(ctx, c.cl, c.lAddr)
 	if err != nil {
 		if errors.Is(err, context.Canceled) {
 			return errUserTermination
@@ -302,136 +2160,293 @@ func run() error {
 		log.Printf("[ERROR] Failed to get lessor account's WAVES balance: %v", err)
 		return errFailure
 	}
-	log.Printf("[INFO] Balance of lessor account '%s': %s", lAddr.String(), format(balance))
-	if irreducibleBalance > 0 {
-		b := int64(balance) - irreducibleBalance
-		if b > 0 {
-			balance = uint64(b)
-		} else {
-			balance = 0
-		}
+	if balance < fee {
+		log.Printf("[ERROR] Not enough balance on lessor's account to pay %s of fee for cancelling lease", format(fee))
+		return errFailure
 	}
-	if balance <= standardFee {
-		log.Print("[ERROR] Not enough balance on lessor's account")
+	cancel, err := newLeaseCancel(c.scheme, c.txVer, c.lSK, c.lPK, lease.ID, fee, c.timestamp())
+	if err != nil {
+		log.Printf("[ERROR] Failed to sign lease cancel transaction: %v", err)
 		return errFailure
 	}
-	if balance > waves && testRun {
-		balance = waves
+	if c.dryRun {
+		logWith(fields{"txId": cancel.ID.String(), "amount": lease.Amount, "fee": fee, "address": lease.Recipient.String()},
+			"[INFO] DRY-RUN: Lease '%s' of %s to '%s' would be cancelled by transaction '%s'",
+			lease.ID.String(), format(lease.Amount), lease.Recipient.String(), cancel.ID.String())
+		if err := c.writeOut(cancel); err != nil {
+			log.Printf("[ERROR] Failed to write lease cancel transaction: %v", err)
+			return errFailure
+		}
+		logWith(fields{"status": "ok"}, "[INFO] OK")
+		return nil
 	}
-	log.Printf("[INFO] Balance available for leasing: %s", format(balance))
-
-	// 7. Create leasing transaction to generating account
-	rcp = proto.NewRecipientFromAddress(gAddr)
-	if leasingAddr != nil { // If different leasing address was provided make recipient of it
-		rcp = proto.NewRecipientFromAddress(*leasingAddr)
+	logWith(fields{"txId": cancel.ID.String(), "amount": lease.Amount, "fee": fee, "address": lease.Recipient.String()},
+		"[INFO] Cancelling lease '%s' of %s to '%s' by transaction '%s'",
+		lease.ID.String(), format(lease.Amount), lease.Recipient.String(), cancel.ID.String())
+	if c.explorerURL != "" {
+		log.Printf("[INFO] Lease cancel transaction in explorer: %s", explorerLink(c.explorerURL, *cancel.ID))
 	}
-	log.Printf("[INFO] Leasing to address: %s", rcp.String())
-	leaseExtraFee, err := getExtraFee(ctx, cl, lAddr)
+	err = broadcast(ctx, c.cl, cancel, c.broadcastRetries)
 	if err != nil {
-		if errors.Is(err, context.Canceled) {
+		if errors.Is(err, context.Canceled) || errors.Is(err, errUserTermination) {
 			return errUserTermination
 		}
-		log.Printf("[ERROR] Failed to check extra fee on account '%s': %v", lAddr.String(), err)
-		return errFailure
-	}
-	if leaseExtraFee != 0 {
-		log.Printf("[INFO] Extra fee on lease: %s", format(leaseExtraFee))
-	} else {
-		log.Print("[INFO] No extra fee on lease")
-	}
-	fee = standardFee + leaseExtraFee
-	amount = balance - fee
-	if amount <= 0 {
-		log.Print("[ERROR] Negative of zero amount to lease")
+		log.Printf("[ERROR] Failed to broadcast lease cancel transaction: %v", err)
 		return errFailure
 	}
-	if leasingThreshold > 0 {
-		if amount < uint64(leasingThreshold) {
-			log.Printf("[INFO] Leasing amount %d is less than threshold %d", amount, leasingThreshold)
-			return nil
+	if c.st != nil {
+		c.st.removeLeaseNote(lease.ID.String())
+		if err := c.saveState(); err != nil {
+			log.Printf("[ERROR] Failed to save state to file '%s': %v", c.stateFile, err)
+			return errFailure
 		}
 	}
-	lease := proto.NewUnsignedLeaseWithProofs(txVer, lPK, rcp, amount, fee, timestamp())
-	err = lease.Sign(scheme, lSK)
+	err = track(ctx, c.cl, *cancel.ID, c.tracking)
 	if err != nil {
-		log.Printf("[ERROR] Failed to sign lease transaction: %v", err)
+		if errors.Is(err, context.Canceled) {
+			return errUserTermination
+		}
+		log.Printf("[ERROR] Failed to track lease cancel transaction: %v", err)
 		return errFailure
 	}
-	if dryRun {
-		b, err := json.Marshal(lease)
-		if err != nil {
-			log.Printf("[ERROR] Failed to make transaction json: %v", err)
-			return errFailure
+	logWith(fields{"status": "ok"}, "[INFO] OK")
+	return nil
+}
+
+// probeNode checks that node is reachable and, if maximum block age is set, that its last block is not too old.
+func probeNode(ctx context.Context, nodeURLs []string, hc *http.Client, maxBlockAge time.Duration) error {
+	c, err := connectNode(ctx, nodeURLs, hc)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return errUserTermination
 		}
-		log.Printf("[INFO] Lease transaction:\n%s", string(b))
-	} else {
-		log.Printf("[INFO] Lease transaction ID: %s", lease.ID.String())
-		err = broadcast(ctx, cl, lease)
+		log.Printf("[ERROR] Node is unreachable: %v", err)
+		return errFailure
+	}
+	if maxBlockAge > 0 {
+		age, err := getLastBlockAge(ctx, &node{Client: c})
 		if err != nil {
 			if errors.Is(err, context.Canceled) {
 				return errUserTermination
 			}
-			log.Printf("[ERROR] Failed to broadcast lease transaction: %v", err)
+			log.Printf("[ERROR] Failed to get node's last block: %v", err)
 			return errFailure
 		}
-		err = track(ctx, cl, *lease.ID)
-		if err != nil {
-			if errors.Is(err, context.Canceled) {
-				return errUserTermination
-			}
-			log.Printf("[ERROR] Failed to track lease transaction: %v", err)
+		if age > maxBlockAge {
+			log.Printf("[ERROR] Node lags behind by %s, more than maximum of %s, it may be not synchronized", age, maxBlockAge)
 			return errFailure
 		}
 	}
-	log.Print("[INFO] OK")
 	return nil
 }
 
-func broadcast(ctx context.Context, cl *client.Client, tx proto.Transaction) error {
-	_, err := cl.Transactions.Broadcast(ctx, tx)
+// broadcast sends the transaction to the node. If the node reports that the transaction is already in the state,
+// for example because the response to previous attempt was lost, the broadcast is considered successful.
+func broadcast(ctx context.Context, cl *node, tx proto.Transaction, retries int) error {
+	if cl.confirm {
+		ok, err := confirmBroadcast(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			log.Print("[INFO] Broadcast is declined by user")
+			return errUserTermination
+		}
+	}
+	err := retry(ctx, retries, "broadcast transaction", func() (*client.Response, error) {
+		if cl.grpc != nil {
+			return nil, cl.grpc.broadcast(ctx, tx)
+		}
+		return cl.Transactions.Broadcast(ctx, tx)
+	})
+	if isAlreadyInState(err) {
+		log.Printf("[INFO] Transaction is already in the state, proceeding with it: %v", err)
+		return nil
+	}
 	return err
 }
 
-func track(ctx context.Context, cl *client.Client, id crypto.Digest) error {
-	log.Printf("[INFO] Waiting for transaction '%s' on blockchain...", id.String())
-	for {
-		_, rsp, err := cl.Transactions.Info(ctx, id)
-		if errors.Is(err, context.Canceled) {
+// broadcastBulk sends the transactions to the node in one request as JSON array. If the node doesn't accept
+// the array, the transactions are broadcasted one by one.
+func broadcastBulk(ctx context.Context, cl *node, txs []proto.Transaction, retries int) error {
+	if cl.grpc == nil && !cl.confirm { // gRPC API has no batch broadcast and each transaction is confirmed separately
+		err := postBulk(ctx, cl, txs, retries)
+		if !errors.Is(err, errBulkUnsupported) {
 			return err
 		}
-		if rsp.StatusCode == http.StatusOK {
-			return nil
+		log.Printf("[WARN] Node does not accept bulk broadcast, broadcasting %d transactions one by one: %v", len(txs), err)
+	}
+	for _, tx := range txs {
+		if err := broadcast(ctx, cl, tx, retries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type bulkResult struct {
+	Error   int    `json:"error"`
+	Message string `json:"message"`
+}
+
+func postBulk(ctx context.Context, cl *node, txs []proto.Transaction, retries int) error {
+	body, err := json.Marshal(txs)
+	if err != nil {
+		return err
+	}
+	var (
+		results []bulkResult
+		status  int
+	)
+	err = retry(ctx, retries, "broadcast transactions", func() (*client.Response, error) {
+		req, err := http.NewRequest("POST", cl.GetOptions().BaseUrl+"/transactions/broadcast", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		results = nil
+		resp, err := cl.Do(ctx, req, &results)
+		if resp != nil && resp.Response != nil {
+			status = resp.StatusCode
+		}
+		return resp, err
+	})
+	if err != nil {
+		var pe *client.ParseError
+		// Node that expects a single transaction fails to parse the array or has no such endpoint
+		if errors.As(err, &pe) || (status >= http.StatusBadRequest && status < http.StatusInternalServerError && status != http.StatusTooManyRequests) {
+			return fmt.Errorf("%w: %v", errBulkUnsupported, err)
 		}
-		time.Sleep(time.Second)
+		return err
 	}
+	if len(results) != len(txs) {
+		return fmt.Errorf("%w: got %d results for %d transactions", errBulkUnsupported, len(results), len(txs))
+	}
+	for i, r := range results {
+		if r.Error != 0 && !strings.Contains(r.Message, "already in the state") {
+			return fmt.Errorf("%w: transaction #%d: %s", errRequestRejected, i+1, r.Message)
+		}
+	}
+	return nil
 }
 
+// timestamp returns current time in milliseconds.
 func timestamp() uint64 {
 	return uint64(time.Now().UnixNano()) / 1000000
 }
 
+// timestamp returns current time in milliseconds shifted by the timestamp offset to compare with node's time.
+func (c *cycle) timestamp() uint64 {
+	return uint64(time.Now().Add(c.timestampOffset).UnixNano()) / 1000000
+}
+
+func feeRatio(fee, amount uint64) float64 {
+	return float64(fee) / float64(amount)
+}
+
+func explorerLink(explorerURL string, id crypto.Digest) string {
+	return strings.TrimRight(explorerURL, "/") + "/tx/" + id.String()
+}
+
+func explainf(format string, args ...interface{}) {
+	if enabled("explain") {
+		log.Printf("[EXPLAIN] "+format, args...)
+	}
+}
+
+func debugf(format string, args ...interface{}) {
+	if enabled("debug") {
+		log.Printf("[DEBUG] "+format, args...)
+	}
+}
+
 func format(amount uint64) string {
 	da := fpd.New(int64(amount), -8)
 	return fmt.Sprintf("%s WAVES", da.FormattedString())
 }
 
-func getAvailableWavesBalance(ctx context.Context, cl *client.Client, addr proto.WavesAddress) (uint64, error) {
-	ab, _, err := cl.Addresses.BalanceDetails(ctx, addr)
+const (
+	balanceAvailable  = "available"
+	balanceGenerating = "generating"
+	balanceEffective  = "effective"
+)
+
+// checkStartBalance reports whether generator's available balance reaches the minimal balance to start with.
+func checkStartBalance(ctx context.Context, cl *node, addr proto.WavesAddress, min uint64) (bool, error) {
+	balance, err := getAvailableWavesBalance(ctx, cl, addr)
+	if err != nil {
+		return false, err
+	}
+	if balance < min {
+		log.Printf("[INFO] Generator's available balance %s is below minimal start balance %s, nothing to do",
+			format(balance), format(min))
+		return false, nil
+	}
+	return true, nil
+}
+
+func getBalanceDetails(ctx context.Context, cl *node, addr proto.WavesAddress) (*client.AddressesBalanceDetails, error) {
+	var ab *client.AddressesBalanceDetails
+	err := retry(ctx, cl.retries, "get balance", func() (*client.Response, error) {
+		var (
+			resp *client.Response
+			err  error
+		)
+		if cl.grpc != nil {
+			ab, err = cl.grpc.balanceDetails(ctx, addr)
+			return nil, err
+		}
+		ab, resp, err = cl.Addresses.BalanceDetails(ctx, addr)
+		return resp, err
+	})
+	return ab, err
+}
+
+func getAvailableWavesBalance(ctx context.Context, cl *node, addr proto.WavesAddress) (uint64, error) {
+	return getWavesBalance(ctx, cl, addr, balanceAvailable)
+}
+
+// getWavesBalance returns the balance of the given kind, but not more than available balance,
+// because generating and effective balances include the leased in WAVES that can't be spent.
+func getWavesBalance(ctx context.Context, cl *node, addr proto.WavesAddress, source string) (uint64, error) {
+	ab, err := getBalanceDetails(ctx, cl, addr)
 	if err != nil {
 		return 0, err
 	}
-	return ab.Available, nil
+	debugf("Balance details of '%s': regular %s, generating %s, available %s, effective %s",
+		addr.String(), format(ab.Regular), format(ab.Generating), format(ab.Available), format(ab.Effective))
+	var b uint64
+	switch source {
+	case balanceGenerating:
+		b = ab.Generating
+	case balanceEffective:
+		b = ab.Effective
+	default:
+		return ab.Available, nil
+	}
+	if b > ab.Available {
+		explainf("The %s balance %s of '%s' is limited to available balance %s", source, format(b), addr.String(), format(ab.Available))
+		return ab.Available, nil
+	}
+	return b, nil
 }
 
-func getExtraFee(ctx context.Context, cl *client.Client, addr proto.WavesAddress) (uint64, error) {
-	info, _, err := cl.Addresses.ScriptInfo(ctx, addr)
+func getExtraFee(ctx context.Context, cl *node, addr proto.WavesAddress) (uint64, error) {
+	var info *client.AddressesScriptInfo
+	err := retry(ctx, cl.retries, "get script info", func() (*client.Response, error) {
+		var (
+			resp *client.Response
+			err  error
+		)
+		info, resp, err = cl.Addresses.ScriptInfo(ctx, addr)
+		return resp, err
+	})
 	if err != nil {
 		return 0, err
 	}
 	return info.ExtraFee, nil
 }
 
-func nodeClient(ctx context.Context, s string) (*client.Client, error) {
+func normalizeURL(s string) (string, error) {
 	var u *url.URL
 	var err error
 	if strings.Contains(s, "//") {
@@ -440,54 +2455,330 @@ func nodeClient(ctx context.Context, s string) (*client.Client, error) {
 		u, err = url.Parse("//" + s)
 	}
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 	if u.Scheme == "" {
 		u.Scheme = defaultScheme
 	}
 	if u.Scheme != "http" && u.Scheme != "https" {
-		return nil, fmt.Errorf("unsupported URL scheme '%s'", u.Scheme)
+		return "", fmt.Errorf("unsupported URL scheme '%s'", u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return "", errors.New("empty host")
+	}
+	// Parser accepts colons in host without scheme, IPv6 address must be in brackets
+	if ip, _, _ := strings.Cut(host, "%"); strings.Contains(host, ":") && (!strings.HasPrefix(u.Host, "[") || net.ParseIP(ip) == nil) {
+		return "", fmt.Errorf("invalid host '%s'", u.Host)
+	}
+	if p := u.Port(); p != "" {
+		if n, err := strconv.ParseUint(p, 10, 16); err != nil || n == 0 {
+			return "", fmt.Errorf("invalid port '%s'", p)
+		}
+	}
+	return u.String(), nil
+}
+
+// connectNode returns the client of the first node that responds, nodes are tried in the given order.
+func connectNode(ctx context.Context, urls []string, hc *http.Client) (*client.Client, error) {
+	var err error
+	for _, u := range urls {
+		var cl *client.Client
+		cl, err = nodeClient(ctx, u, hc)
+		if err == nil {
+			return cl, nil
+		}
+		if errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		if len(urls) > 1 {
+			log.Printf("[WARN] Node at '%s' is unavailable: %v", u, err)
+		}
+	}
+	if len(urls) > 1 {
+		return nil, errors.New("all nodes are unavailable")
+	}
+	return nil, fmt.Errorf("node at '%s' is unavailable: %w", urls[0], err)
+}
+
+func nodeClient(ctx context.Context, s string, hc *http.Client) (*client.Client, error) {
+	u, err := normalizeURL(s)
+	if err != nil {
+		return nil, err
 	}
-	cl, err := client.NewClient(client.Options{BaseUrl: u.String(), Client: &http.Client{}})
+	cl, err := client.NewClient(client.Options{BaseUrl: u, Client: hc})
 	if err != nil {
 		return nil, err
 	}
-	_, _, err = cl.Blocks.Height(ctx)
+	h, _, err := cl.Blocks.Height(ctx)
 	if err != nil {
+		var pe *client.ParseError
+		if errors.As(err, &pe) {
+			return nil, fmt.Errorf("%w: invalid height: %v", errNotWavesNode, err)
+		}
 		return nil, err
 	}
+	if h == nil || h.Height == 0 {
+		return nil, fmt.Errorf("%w: no height", errNotWavesNode)
+	}
 	return cl, nil
 }
 
-func getScheme(ctx context.Context, cl *client.Client) (proto.Scheme, error) {
+func getScheme(ctx context.Context, cl *node) (proto.Scheme, error) {
+	if cl.grpc != nil {
+		var s proto.Scheme
+		err := retry(ctx, cl.retries, "get chain ID", func() (*client.Response, error) {
+			var err error
+			s, err = cl.grpc.chainID(ctx)
+			return nil, err
+		})
+		if err != nil {
+			return 0, err
+		}
+		if !isPlausibleScheme(s) {
+			return 0, fmt.Errorf("%w: chain ID 0x%02x of last block", errImplausibleScheme, s)
+		}
+		return s, nil
+	}
+	var b *client.Block
+	err := retry(ctx, cl.retries, "get last block", func() (*client.Response, error) {
+		var (
+			resp *client.Response
+			err  error
+		)
+		b, resp, err = cl.Blocks.Last(ctx)
+		return resp, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	debugf("Last block at height %d generated by '%s'", b.Height, b.Generator.String())
+	ab := b.Generator.Bytes()
+	if len(ab) < 2 {
+		return 0, fmt.Errorf("%w: invalid generator address '%s'", errImplausibleScheme, b.Generator.String())
+	}
+	s := ab[1]
+	if !isPlausibleScheme(s) {
+		return 0, fmt.Errorf("%w: byte 0x%02x of generator address '%s'", errImplausibleScheme, s, b.Generator.String())
+	}
+	return s, nil
+}
+
+func isPlausibleScheme(s proto.Scheme) bool {
+	return (s >= 'A' && s <= 'Z') || (s >= 'a' && s <= 'z')
+}
+
+func recipientScheme(r proto.Recipient) proto.Scheme {
+	if r.Alias != nil {
+		return r.Alias.Scheme
+	}
+	return r.Address.Bytes()[1]
+}
+
+// parseRecipient accepts Base58 encoded address or alias in form 'alias:<scheme>:<name>'.
+func parseRecipient(s string) (proto.Recipient, error) {
+	if strings.HasPrefix(s, proto.AliasPrefix+":") {
+		a, err := proto.NewAliasFromString(s)
+		if err != nil {
+			return proto.Recipient{}, err
+		}
+		if _, err := a.Valid(); err != nil {
+			return proto.Recipient{}, err
+		}
+		if !isPlausibleScheme(a.Scheme) {
+			return proto.Recipient{}, fmt.Errorf("invalid scheme '%s' of alias", string(a.Scheme))
+		}
+		return proto.NewRecipientFromAlias(*a), nil
+	}
+	a, err := proto.NewAddressFromString(s)
+	if err != nil {
+		return proto.Recipient{}, err
+	}
+	return proto.NewRecipientFromAddress(a), nil
+}
+
+func getLastBlockAge(ctx context.Context, cl *node) (time.Duration, error) {
 	b, _, err := cl.Blocks.Last(ctx)
 	if err != nil {
 		return 0, err
 	}
-	return b.Generator.Bytes()[1], nil
+	return time.Since(time.UnixMilli(int64(b.Timestamp))).Round(time.Second), nil
+}
+
+type versionResponse struct {
+	Version string `json:"version"`
+}
+
+func getNodeVersion(ctx context.Context, cl *node) (string, error) {
+	req, err := http.NewRequest("GET", cl.GetOptions().BaseUrl+"/node/version", nil)
+	if err != nil {
+		return "", err
+	}
+	v := new(versionResponse)
+	if _, err := cl.Do(ctx, req, v); err != nil {
+		return "", err
+	}
+	return v.Version, nil
+}
+
+type timeResponse struct {
+	System uint64 `json:"system"`
+	NTP    uint64 `json:"NTP"`
+}
+
+// getClockSkew returns the difference between shifted local time and node's time. The request is made directly
+// because the client requires an API key for it, though the node does not.
+func getClockSkew(ctx context.Context, cl *node, offset time.Duration) (time.Duration, error) {
+	req, err := http.NewRequest("GET", cl.GetOptions().BaseUrl+"/utils/time", nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	t := new(timeResponse)
+	if _, err := cl.Do(ctx, req, t); err != nil {
+		return 0, err
+	}
+	local := start.Add(time.Since(start)/2 + offset)
+	return local.Sub(time.UnixMilli(int64(t.System))).Round(time.Millisecond), nil
+}
+
+func getConnectedPeersCount(ctx context.Context, cl *node) (int, error) {
+	peersRequest, err := http.NewRequest("GET", cl.GetOptions().BaseUrl+"/peers/connected", nil)
+	if err != nil {
+		return 0, err
+	}
+	resp := new(peersResponse)
+	_, err = cl.Do(ctx, peersRequest, resp)
+	if err != nil {
+		return 0, err
+	}
+	return len(resp.Peers), nil
+}
+
+const protobufFeatureID = 15
+
+func getActivationStatus(ctx context.Context, cl *node) (*activationStatusResponse, error) {
+	var status *activationStatusResponse
+	err := retry(ctx, cl.retries, "get activation status", func() (*client.Response, error) {
+		if cl.grpc != nil {
+			var err error
+			status, err = cl.grpc.activationStatus(ctx)
+			return nil, err
+		}
+		statusRequest, err := http.NewRequest("GET", cl.GetOptions().BaseUrl+"/activation/status", nil)
+		if err != nil {
+			return nil, err
+		}
+		status = new(activationStatusResponse)
+		return cl.Do(ctx, statusRequest, status)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (r *activationStatusResponse) feature(id int) *feature {
+	for i := range r.Features {
+		if r.Features[i].ID == id {
+			return &r.Features[i]
+		}
+	}
+	return nil
+}
+
+func getFeature(ctx context.Context, cl *node, id int) (*feature, error) {
+	resp, err := getActivationStatus(ctx, cl)
+	if err != nil {
+		return nil, err
+	}
+	return resp.feature(id), nil
+}
+
+func (f *feature) activated() bool {
+	return f != nil && f.BlockchainStatus == "ACTIVATED" && (f.NodeStatus == "IMPLEMENTED" || f.NodeStatus == "VOTED")
 }
 
-func isProtobufActivated(ctx context.Context, cl *client.Client) (bool, error) {
-	statusRequest, err := http.NewRequest("GET", cl.GetOptions().BaseUrl+"/activation/status", nil)
+func isFeatureActivated(ctx context.Context, cl *node, id int) (bool, error) {
+	f, err := getFeature(ctx, cl, id)
 	if err != nil {
 		return false, err
 	}
-	resp := new(activationStatusResponse)
-	_, err = cl.Do(ctx, statusRequest, resp)
+	return f.activated(), nil
+}
+
+// isProtobufActivated also treats the approved feature as activated if the activation height is already reached.
+func isProtobufActivated(ctx context.Context, cl *node, id int) (bool, error) {
+	resp, err := getActivationStatus(ctx, cl)
 	if err != nil {
 		return false, err
 	}
-	for _, f := range resp.Features {
-		if f.ID == 15 && f.BlockchainStatus == "ACTIVATED" && (f.NodeStatus == "IMPLEMENTED" || f.NodeStatus == "VOTED") {
+	if len(resp.Features) == 0 {
+		log.Print("[WARN] Node reports no features, Protobuf transactions are considered unsupported")
+		return false, nil
+	}
+	f := resp.feature(id)
+	switch {
+	case f == nil:
+		log.Printf("[WARN] Protobuf feature #%d is unknown to node", id)
+		return false, nil
+	case f.activated():
+		return true, nil
+	case f.BlockchainStatus == "APPROVED":
+		if f.ActivationHeight > 0 && resp.Height >= f.ActivationHeight {
 			return true, nil
 		}
+		log.Printf("[INFO] Protobuf feature #%d is approved and will be activated at height %d", id, f.ActivationHeight)
+		return false, nil
+	default:
+		return false, nil
+	}
+}
+
+func waitForFeature(ctx context.Context, cl *node, id int, wait bool) (bool, error) {
+	for {
+		f, err := getFeature(ctx, cl, id)
+		if err != nil {
+			return false, err
+		}
+		if f == nil {
+			log.Printf("[INFO] Feature #%d is unknown to node", id)
+		} else {
+			log.Printf("[INFO] Feature #%d '%s': blockchain status %s, node status %s",
+				f.ID, f.Description, f.BlockchainStatus, f.NodeStatus)
+		}
+		if f.activated() || !wait {
+			return f.activated(), nil
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(featurePollInterval):
+		}
 	}
-	return false, nil
 }
 
 func showUsage() {
 	_, _ = fmt.Fprintf(os.Stderr, "\nUsage of Waves Automatic Lessor %s\n", version)
 	flag.PrintDefaults()
+	_, _ = fmt.Fprintf(os.Stderr, "\nExit codes:\n")
+	_, _ = fmt.Fprintf(os.Stderr, "  %d\tsuccess, including runs that made no transactions\n", exitOK)
+	_, _ = fmt.Fprintf(os.Stderr, "  %d\tunexpected error\n", exitError)
+	_, _ = fmt.Fprintf(os.Stderr, "  %d\tinvalid parameters\n", exitInvalidParameters)
+	_, _ = fmt.Fprintf(os.Stderr, "  %d\tlease amount is below leasing threshold, only with -threshold-exit-code\n", exitBelowThreshold)
+	_, _ = fmt.Fprintf(os.Stderr, "  %d\toperation failure\n", exitFailure)
+	_, _ = fmt.Fprintf(os.Stderr, "  %d\tterminated by user\n", exitUserTermination)
+}
+
+func loadSK(ctx context.Context, scheme proto.Scheme, s string, p secretProvider) (crypto.SecretKey, crypto.PublicKey, proto.WavesAddress, error) {
+	if p == nil {
+		return parseSK(scheme, s)
+	}
+	sk, err := fetchSK(ctx, p)
+	if err != nil {
+		return crypto.SecretKey{}, crypto.PublicKey{}, proto.WavesAddress{}, err
+	}
+	return account(scheme, sk)
 }
 
 func parseSK(scheme proto.Scheme, s string) (crypto.SecretKey, crypto.PublicKey, proto.WavesAddress, error) {
@@ -495,6 +2786,10 @@ func parseSK(scheme proto.Scheme, s string) (crypto.SecretKey, crypto.PublicKey,
 	if err != nil {
 		return crypto.SecretKey{}, crypto.PublicKey{}, proto.WavesAddress{}, err
 	}
+	return account(scheme, sk)
+}
+
+func account(scheme proto.Scheme, sk crypto.SecretKey) (crypto.SecretKey, crypto.PublicKey, proto.WavesAddress, error) {
 	pk := crypto.GeneratePublicKey(sk)
 	address, err := proto.NewAddressFromPublicKey(scheme, pk)
 	if err != nil {
@@ -0,0 +1,800 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wavesplatform/gowaves/pkg/crypto"
+	"github.com/wavesplatform/gowaves/pkg/proto"
+)
+
+const testBlockID = "4HxKByB8vHF8pGdUzn6Bhf2959NQC5abfGSF13o8Ndv39kQMkqmcC1C6byRJVV5d8w2rLvwCZmdfj8Qr1tk3LvYq"
+
+type testAccount struct {
+	sk   crypto.SecretKey
+	pk   crypto.PublicKey
+	addr proto.WavesAddress
+}
+
+func newTestAccount(t *testing.T, seed string) testAccount {
+	t.Helper()
+	sk, pk, err := crypto.GenerateKeyPair([]byte(seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := proto.NewAddressFromPublicKey(proto.MainNetScheme, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testAccount{sk: sk, pk: pk, addr: addr}
+}
+
+// mockNode serves the part of node's REST API used by the tool. Balances of unknown addresses are zero.
+// Broadcasted transactions are put in block at once, transfers and lease cancels are applied to balances.
+type mockNode struct {
+	mu         sync.Mutex
+	generator  proto.WavesAddress
+	balances   map[proto.WavesAddress]uint64
+	leases     []map[string]interface{}
+	broadcasts []map[string]interface{}
+	statuses   map[string]string // Application status of transactions other than succeeded
+	extraFees  map[proto.WavesAddress]uint64
+	flaky      bool          // Every other balance request fails with 503
+	blockAge   time.Duration // Age of the last block
+	bulk       bool          // Broadcast accepts JSON array of transactions
+	balanceReq int
+	requests   []string
+
+	onBroadcast func(tx map[string]interface{})
+}
+
+func newMockNode(t *testing.T, generator proto.WavesAddress) (*mockNode, *httptest.Server) {
+	t.Helper()
+	n := &mockNode{generator: generator, balances: make(map[proto.WavesAddress]uint64)}
+	srv := httptest.NewServer(n)
+	t.Cleanup(srv.Close)
+	return n, srv
+}
+
+func (n *mockNode) setBalance(addr proto.WavesAddress, b uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.balances[addr] = b
+}
+
+func (n *mockNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.requests = append(n.requests, r.Method+" "+r.URL.Path)
+	p := r.URL.Path
+	send := func(code int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	last := func(prefix string) string { return strings.TrimPrefix(p, prefix) }
+	switch {
+	case p == "/blocks/height":
+		send(http.StatusOK, map[string]interface{}{"height": 1000})
+	case p == "/blocks/last":
+		send(http.StatusOK, map[string]interface{}{
+			"version": 5, "timestamp": time.Now().Add(-n.blockAge).UnixMilli(), "reference": testBlockID,
+			"nxt-consensus": map[string]interface{}{"base-target": 1, "generation-signature": ""},
+			"generator":     n.generator.String(), "signature": testBlockID, "id": testBlockID,
+			"height": 1000, "transactions": []interface{}{},
+		})
+	case p == "/activation/status":
+		send(http.StatusOK, map[string]interface{}{"height": 1000, "votingInterval": 1, "votingThreshold": 1, "nextCheck": 1,
+			"features": []interface{}{}})
+	case p == "/node/version":
+		send(http.StatusOK, map[string]interface{}{"version": "Waves v1.4.0"})
+	case strings.HasPrefix(p, "/addresses/balance/details/"):
+		n.balanceReq++
+		if n.flaky && n.balanceReq%2 == 1 {
+			send(http.StatusServiceUnavailable, map[string]interface{}{"error": 0, "message": "service unavailable"})
+			return
+		}
+		a, err := proto.NewAddressFromString(last("/addresses/balance/details/"))
+		if err != nil {
+			send(http.StatusBadRequest, map[string]interface{}{"error": 102, "message": "invalid address"})
+			return
+		}
+		b := n.balances[a]
+		send(http.StatusOK, map[string]interface{}{"address": a.String(), "regular": b, "generating": b, "available": b, "effective": b})
+	case strings.HasPrefix(p, "/addresses/scriptInfo/"):
+		a, err := proto.NewAddressFromString(last("/addresses/scriptInfo/"))
+		if err != nil {
+			send(http.StatusBadRequest, map[string]interface{}{"error": 102, "message": "invalid address"})
+			return
+		}
+		send(http.StatusOK, map[string]interface{}{"address": a.String(), "complexity": 0, "extraFee": n.extraFees[a]})
+	case strings.HasPrefix(p, "/leasing/active/"):
+		leases := n.leases
+		if leases == nil {
+			leases = []map[string]interface{}{}
+		}
+		send(http.StatusOK, leases)
+	case p == "/transactions/calculateFee":
+		var tx map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+			send(http.StatusBadRequest, map[string]interface{}{"error": 1, "message": err.Error()})
+			return
+		}
+		fee := uint64(standardFee)
+		if spk, err := crypto.NewPublicKeyFromBase58(tx["senderPublicKey"].(string)); err == nil {
+			if sender, err := proto.NewAddressFromPublicKey(proto.MainNetScheme, spk); err == nil {
+				fee += n.extraFees[sender]
+			}
+		}
+		send(http.StatusOK, map[string]interface{}{"feeAssetId": nil, "feeAmount": fee})
+	case p == "/transactions/broadcast" && n.bulk:
+		var txs []map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&txs); err != nil {
+			send(http.StatusBadRequest, map[string]interface{}{"error": 1, "message": err.Error()})
+			return
+		}
+		for _, tx := range txs {
+			n.broadcasts = append(n.broadcasts, tx)
+			n.apply(tx)
+		}
+		send(http.StatusOK, txs)
+	case p == "/transactions/broadcast":
+		var tx map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+			send(http.StatusBadRequest, map[string]interface{}{"error": 1, "message": err.Error()})
+			return
+		}
+		if n.onBroadcast != nil {
+			n.onBroadcast(tx)
+		}
+		n.broadcasts = append(n.broadcasts, tx)
+		n.apply(tx)
+		send(http.StatusOK, tx)
+	case strings.HasPrefix(p, "/transactions/info/"):
+		id := last("/transactions/info/")
+		for _, tx := range n.broadcasts {
+			if tx["id"] == id {
+				info := map[string]interface{}{"height": 1000, "applicationStatus": "succeeded"}
+				for k, v := range tx {
+					info[k] = v
+				}
+				if s, ok := n.statuses[id]; ok {
+					info["applicationStatus"] = s
+				}
+				send(http.StatusOK, info)
+				return
+			}
+		}
+		send(http.StatusNotFound, map[string]interface{}{"error": 311, "message": "transactions does not exist"})
+	default:
+		send(http.StatusNotFound, map[string]interface{}{"error": 1, "message": "not found"})
+	}
+}
+
+func (n *mockNode) apply(tx map[string]interface{}) {
+	if tx["type"] != float64(proto.TransferTransaction) && tx["type"] != float64(proto.LeaseCancelTransaction) {
+		return
+	}
+	spk, err := crypto.NewPublicKeyFromBase58(tx["senderPublicKey"].(string))
+	if err != nil {
+		return
+	}
+	sender, err := proto.NewAddressFromPublicKey(proto.MainNetScheme, spk)
+	if err != nil {
+		return
+	}
+	if tx["type"] == float64(proto.LeaseCancelTransaction) { // Amount of cancelled lease becomes available
+		for i, l := range n.leases {
+			if l["id"] == tx["leaseId"] {
+				n.balances[sender] += uint64(l["amount"].(float64)) - uint64(tx["fee"].(float64))
+				n.leases = append(n.leases[:i:i], n.leases[i+1:]...)
+				break
+			}
+		}
+		return
+	}
+	rcp, err := proto.NewAddressFromString(tx["recipient"].(string))
+	if err != nil {
+		return
+	}
+	amount, fee := uint64(tx["amount"].(float64)), uint64(tx["fee"].(float64))
+	n.balances[sender] -= amount + fee
+	n.balances[rcp] += amount
+}
+
+func (n *mockNode) broadcasted(typ proto.TransactionType) []map[string]interface{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var r []map[string]interface{}
+	for _, tx := range n.broadcasts {
+		if tx["type"] == float64(typ) {
+			r = append(r, tx)
+		}
+	}
+	return r
+}
+
+func testConfig(nodeURL string, generator, lessor testAccount) Config {
+	return Config{
+		NodeURL:             nodeURL,
+		GeneratingSKs:       secretList{generator.sk.String()},
+		LessorSK:            lessor.sk.String(),
+		IrreducibleBalance:  waves,
+		TransferPercent:     100,
+		BalanceSource:       balanceAvailable,
+		Rounding:            roundingFirst,
+		APIRetries:          0,
+		BroadcastRetries:    0,
+		HTTPTimeout:         5 * time.Second,
+		ProtobufFeature:     protobufFeatureID,
+		ConfirmationTimeout: time.Second,
+		PollInterval:        10 * time.Millisecond,
+		Confirmations:       1,
+		RawFormat:           "hex",
+		FeeMultiplier:       1,
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	g, l := newTestAccount(t, "generator"), newTestAccount(t, "lessor")
+	n, srv := newMockNode(t, g.addr)
+	n.setBalance(g.addr, 10*waves)
+	cfg := testConfig(srv.URL, g, l)
+	cfg.DryRun = true
+	if err := run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() = %v, want nil", err)
+	}
+	if len(n.broadcasts) != 0 {
+		t.Errorf("%d transactions broadcasted in dry-run", len(n.broadcasts))
+	}
+}
+
+func TestRunDryRunProjectionRetries(t *testing.T) {
+	g, l := newTestAccount(t, "generator"), newTestAccount(t, "lessor")
+	n, srv := newMockNode(t, g.addr)
+	n.setBalance(g.addr, 10*waves)
+	n.flaky = true
+	cfg := testConfig(srv.URL, g, l)
+	cfg.DryRun = true
+	cfg.APIRetries = 1
+	out := captureLog(t)
+	if err := run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() = %v, want nil:\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "Projected balances") || strings.Contains(out.String(), "for projection") {
+		t.Errorf("balances are not projected:\n%s", out.String())
+	}
+}
+
+func TestRunTransferAndLease(t *testing.T) {
+	g, l := newTestAccount(t, "generator"), newTestAccount(t, "lessor")
+	n, srv := newMockNode(t, g.addr)
+	n.setBalance(g.addr, 10*waves)
+	n.setBalance(l.addr, 2*waves)
+	if err := run(context.Background(), testConfig(srv.URL, g, l)); err != nil {
+		t.Fatalf("run() = %v, want nil", err)
+	}
+	transfers := n.broadcasted(proto.TransferTransaction)
+	if len(transfers) != 1 || transfers[0]["amount"] != float64(9*waves-standardFee) {
+		t.Fatalf("transfers = %v, want one transfer of %d", transfers, 9*waves-standardFee)
+	}
+	leases := n.broadcasted(proto.LeaseTransaction)
+	// Lessor keeps the irreducible balance and pays the lease fee from the rest
+	if want := float64(10*waves - 2*standardFee); len(leases) != 1 || leases[0]["amount"] != want || leases[0]["recipient"] != g.addr.String() {
+		t.Fatalf("leases = %v, want one lease of %v to '%s'", leases, want, g.addr.String())
+	}
+}
+
+func TestRunInvalidParameters(t *testing.T) {
+	g, l := newTestAccount(t, "generator"), newTestAccount(t, "lessor")
+	tests := []struct {
+		name   string
+		modify func(*Config)
+	}{
+		{"unknown network", func(c *Config) { c.Network = "devnet" }},
+		{"scheme contradicts network", func(c *Config) { c.Network, c.Scheme = "mainnet", "T" }},
+		{"chain ID contradicts network", func(c *Config) { c.Network, c.ChainID = "testnet", "W" }},
+		{"expected scheme contradicts network", func(c *Config) { c.Network, c.ExpectedScheme = "stagenet", "T" }},
+		{"scheme contradicts expected scheme", func(c *Config) { c.Scheme, c.ExpectedScheme = "W", "T" }},
+		{"invalid chain ID", func(c *Config) { c.ChainID = "1" }},
+		{"invalid node URL", func(c *Config) { c.NodeURL = "ftp://node" }},
+		{"malformed node URL", func(c *Config) { c.NodeURL = "ht!tp://::::" }},
+		{"empty node URL in list", func(c *Config) { c.NodeURL = "http://node1,,http://node2" }},
+		{"node URLs without comma", func(c *Config) { c.NodeURL = "http://node1 http://node2" }},
+		{"negative API retries", func(c *Config) { c.APIRetries = -1 }},
+		{"zero confirmation timeout", func(c *Config) { c.ConfirmationTimeout = 0 }},
+		{"transfer percent above 100", func(c *Config) { c.TransferPercent = 101 }},
+		{"invalid rounding", func(c *Config) { c.Rounding = "middle" }},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig("http://127.0.0.1:1", g, l)
+			tc.modify(&cfg)
+			err := run(context.Background(), cfg)
+			if !errors.Is(err, errInvalidParameters) {
+				t.Fatalf("run() = %v, want %v", err, errInvalidParameters)
+			}
+			var se *StepError
+			if !errors.As(err, &se) || se.Step != stepParameters {
+				t.Errorf("run() = %v, want error of step '%s'", err, stepParameters)
+			}
+		})
+	}
+}
+
+func TestRunIndependentConfigs(t *testing.T) {
+	g, l := newTestAccount(t, "generator"), newTestAccount(t, "lessor")
+	n, srv := newMockNode(t, g.addr)
+	n.setBalance(g.addr, 10*waves)
+	cfg := testConfig(srv.URL, g, l)
+	cfg.DryRun = true
+	cfg.APIRetries = -1
+	if err := run(context.Background(), cfg); !errors.Is(err, errInvalidParameters) {
+		t.Fatalf("run() = %v, want %v", err, errInvalidParameters)
+	}
+	cfg.APIRetries = 0
+	if err := run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() after run with invalid configuration = %v, want nil", err)
+	}
+}
+
+// newWebhookReceiver returns the URL to post notifications to and the function that returns the received ones.
+func newWebhookReceiver(t *testing.T) (string, func() []webhookPayload) {
+	t.Helper()
+	var (
+		mu       sync.Mutex
+		received []webhookPayload
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p webhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("invalid notification: %v", err)
+		}
+		mu.Lock()
+		received = append(received, p)
+		mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, func() []webhookPayload {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]webhookPayload(nil), received...)
+	}
+}
+
+func TestBalanceAlertCoveredByIrreducibleBalance(t *testing.T) {
+	g, l := newTestAccount(t, "generator"), newTestAccount(t, "lessor")
+	n, srv := newMockNode(t, g.addr)
+	n.setBalance(g.addr, waves) // Exactly the irreducible balance
+	hookURL, received := newWebhookReceiver(t)
+	cfg := testConfig(srv.URL, g, l)
+	cfg.BalanceAlert = 5 * waves
+	cfg.WebhookURL = hookURL
+	if err := run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() = %v, want nil", err)
+	}
+	if len(n.broadcasts) != 0 {
+		t.Errorf("%d transactions broadcasted, want none", len(n.broadcasts))
+	}
+	var alerts int
+	for _, p := range received() {
+		if p.Status == "alert" {
+			alerts++
+		}
+	}
+	if alerts != 1 {
+		t.Errorf("%d alerts received, want 1: %v", alerts, received())
+	}
+}
+
+// captureLog redirects the log to the returned buffer until the end of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	b := new(bytes.Buffer)
+	log.SetOutput(b)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return b
+}
+
+func TestBalanceBelowFeeWithExtraFee(t *testing.T) {
+	const extraFee = 4 * standardFee / 10
+	tests := []struct {
+		name    string
+		lessor  string
+		message string
+	}{
+		{"transfer", "lessor", "not enough to pay transfer fee"},
+		{"lease", "generator", "not enough to pay lease fees"}, // Lessor is generator, so there is no transfer
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g, l := newTestAccount(t, "generator"), newTestAccount(t, tc.lessor)
+			n, srv := newMockNode(t, g.addr)
+			// Balance above irreducible balance exceeds the standard fee, but not the fee with extra fee
+			n.setBalance(g.addr, waves+standardFee+extraFee/2)
+			n.extraFees = map[proto.WavesAddress]uint64{g.addr: extraFee}
+			out := captureLog(t)
+			cfg := testConfig(srv.URL, g, l)
+			if l.addr == g.addr {
+				cfg.LeasingAddress = newTestAccount(t, "recipient").addr.String()
+			}
+			if err := run(context.Background(), cfg); !errors.Is(err, errFailure) {
+				t.Fatalf("run() = %v, want %v:\n%s", err, errFailure, out.String())
+			}
+			if len(n.broadcasts) != 0 {
+				t.Errorf("%d transactions broadcasted, want none", len(n.broadcasts))
+			}
+			if !strings.Contains(out.String(), tc.message) {
+				t.Errorf("log has no '%s':\n%s", tc.message, out.String())
+			}
+		})
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+		ok  bool
+	}{
+		{"http://127.0.0.1:6869", "http://127.0.0.1:6869", true},
+		{"https://nodes.wavesnodes.com", "https://nodes.wavesnodes.com", true},
+		{"https://nodes.wavesnodes.com/", "https://nodes.wavesnodes.com/", true},
+		{"127.0.0.1:6869", "http://127.0.0.1:6869", true},
+		{"localhost", "http://localhost", true},
+		{"//node:6869", "http://node:6869", true},
+		{"[::1]:6869", "http://[::1]:6869", true},
+		{"HTTPS://node", "https://node", true},
+		{"http://[fe80::1%25eth0]:6869", "http://[fe80::1%25eth0]:6869", true},
+		{"node:65535", "http://node:65535", true},
+		{"ht!tp://::::", "", false},
+		{"ftp://node", "", false},
+		{"grpc://node:6870", "", false},
+		{"http://", "", false},
+		{"http:///path", "", false},
+		{"http://node:port", "", false},
+		{"http://[::1", "", false},
+		{"::::", "", false},
+		{"::1", "", false},
+		{"[zz::1]:6869", "", false},
+		{"node:0", "", false},
+		{"node:65536", "", false},
+		{"%zz", "", false},
+		{"", "", false},
+	}
+	for _, tc := range tests {
+		out, err := normalizeURL(tc.in)
+		if tc.ok && err != nil {
+			t.Errorf("normalizeURL(%q) unexpected error: %v", tc.in, err)
+			continue
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("normalizeURL(%q) = %q, want error", tc.in, out)
+			continue
+		}
+		if out != tc.out {
+			t.Errorf("normalizeURL(%q) = %q, want %q", tc.in, out, tc.out)
+		}
+	}
+}
+
+func TestConnectNodeNotWavesNode(t *testing.T) {
+	page := func(code int, body string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(code)
+			_, _ = w.Write([]byte(body))
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	const html = "<html><head><title>Welcome</title></head><body><h1>It works!</h1></body></html>"
+	tests := []struct {
+		name     string
+		srv      *httptest.Server
+		notWaves bool
+	}{
+		{"HTML page", page(http.StatusOK, html), true},
+		{"empty JSON", page(http.StatusOK, "{}"), true},
+		{"zero height", page(http.StatusOK, `{"height":0}`), true},
+		{"HTML error page", page(http.StatusBadGateway, "<html><body><h1>502 Bad Gateway</h1></body></html>"), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := connectNode(context.Background(), []string{tc.srv.URL}, tc.srv.Client())
+			if err == nil {
+				t.Fatal("connectNode() succeeded, want error")
+			}
+			if errors.Is(err, errNotWavesNode) != tc.notWaves {
+				t.Errorf("connectNode() = %v, not Waves node error expected %t", err, tc.notWaves)
+			}
+		})
+	}
+
+	// Server that is not a node is skipped like unavailable one
+	g := newTestAccount(t, "generator")
+	_, srv := newMockNode(t, g.addr)
+	cl, err := connectNode(context.Background(), []string{tests[0].srv.URL, srv.URL}, srv.Client())
+	if err != nil {
+		t.Fatalf("connectNode() = %v, want nil", err)
+	}
+	if u := cl.GetOptions().BaseUrl; u != srv.URL {
+		t.Errorf("connected to '%s', want '%s'", u, srv.URL)
+	}
+}
+
+func TestRunNotWavesNode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html><body>Not a node</body></html>"))
+	}))
+	defer srv.Close()
+	out := captureLog(t)
+	err := run(context.Background(), testConfig(srv.URL, newTestAccount(t, "generator"), newTestAccount(t, "lessor")))
+	if err == nil {
+		t.Fatal("run() succeeded, want error")
+	}
+	if !strings.Contains(out.String(), errNotWavesNode.Error()) {
+		t.Errorf("log does not explain that URL is not a node API:\n%s", out.String())
+	}
+}
+
+func TestRunNetworkPresetScheme(t *testing.T) {
+	g, l := newTestAccount(t, "generator"), newTestAccount(t, "lessor")
+	n, srv := newMockNode(t, g.addr)
+	n.setBalance(g.addr, 10*waves)
+	tests := []struct {
+		network string
+		ok      bool
+	}{
+		{"mainnet", true},
+		{"testnet", false},
+		{"stagenet", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.network, func(t *testing.T) {
+			cfg := testConfig(srv.URL, g, l) // Node of the preset is replaced with the mock of MainNet node
+			cfg.Network = tc.network
+			cfg.DryRun = true
+			err := run(context.Background(), cfg)
+			if tc.ok {
+				if err != nil {
+					t.Fatalf("run() = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, errInvalidParameters) {
+				t.Fatalf("run() = %v, want %v", err, errInvalidParameters)
+			}
+			var se *StepError
+			if !errors.As(err, &se) || se.Step != stepScheme {
+				t.Errorf("run() = %v, want error of step '%s'", err, stepScheme)
+			}
+		})
+	}
+}
+
+func TestRunSkipsShares(t *testing.T) {
+	g, a, b := newTestAccount(t, "generator"), newTestAccount(t, "recipient a"), newTestAccount(t, "recipient b")
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   map[proto.WavesAddress]uint64
+		err    error
+	}{
+		{"all shares", func(*Config) {}, map[proto.WavesAddress]uint64{a.addr: 9 * waves, b.addr: waves}, nil},
+		{"share below threshold", func(c *Config) { c.LeasingThreshold = 2 * waves },
+			map[proto.WavesAddress]uint64{a.addr: 9 * waves}, nil},
+		{"share rounds to zero", func(c *Config) { c.RoundLease = true; c.LeaseAmount = 10*waves - 5*waves/10 },
+			map[proto.WavesAddress]uint64{a.addr: 8 * waves}, nil},
+		{"all shares round to zero", func(c *Config) { c.RoundLease = true; c.LeaseAmount = waves - 1 }, nil, nil},
+		{"share fee ratio exceeds maximum", func(c *Config) { c.MaxFeeRatio = float64(standardFee) / (2 * waves) },
+			map[proto.WavesAddress]uint64{a.addr: 9 * waves}, nil},
+		{"all shares fee ratio exceeds maximum", func(c *Config) { c.MaxFeeRatio = float64(standardFee) / (10 * waves) }, nil, nil},
+		{"all shares below threshold", func(c *Config) { c.LeasingThreshold = 10 * waves; c.ThresholdExitCode = true },
+			nil, errBelowThreshold},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			n, srv := newMockNode(t, g.addr)
+			// Lessor is generator, so all above irreducible balance and fees is split between recipients
+			n.setBalance(g.addr, waves+10*waves+2*standardFee)
+			cfg := testConfig(srv.URL, g, g)
+			cfg.LeasingAddress = a.addr.String() + ":9," + b.addr.String() + ":1"
+			tc.modify(&cfg)
+			if err := run(context.Background(), cfg); !errors.Is(err, tc.err) {
+				t.Fatalf("run() = %v, want %v", err, tc.err)
+			}
+			leases := n.broadcasted(proto.LeaseTransaction)
+			got := make(map[proto.WavesAddress]uint64, len(leases))
+			for _, l := range leases {
+				rcp, err := proto.NewAddressFromString(l["recipient"].(string))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got[rcp] = uint64(l["amount"].(float64))
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("leases = %v, want %v", got, tc.want)
+			}
+			for rcp, amount := range tc.want {
+				if got[rcp] != amount {
+					t.Errorf("lease to '%s' = %d, want %d", rcp.String(), got[rcp], amount)
+				}
+			}
+		})
+	}
+}
+
+func TestRunReportOnlyChanged(t *testing.T) {
+	g, l := newTestAccount(t, "generator"), newTestAccount(t, "lessor")
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		runs   int // Runs with the log written
+	}{
+		{"all runs without flag", func(*Config) {}, 3},
+		{"first run with flag", func(c *Config) { c.ReportOnlyChanged = true }, 1},
+		{"runs with warnings", func(c *Config) { c.ReportOnlyChanged = true; c.BalanceAlert = 5 * waves }, 3},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			n, srv := newMockNode(t, g.addr)
+			n.setBalance(g.addr, waves) // Nothing to transfer and lease in every run
+			cfg := testConfig(srv.URL, g, l)
+			cfg.Interval = time.Millisecond
+			cfg.MaxIterations = 3
+			tc.modify(&cfg)
+			out := captureLog(t)
+			if err := run(context.Background(), cfg); err != nil {
+				t.Fatalf("run() = %v, want nil", err)
+			}
+			if c := strings.Count(out.String(), "Balance of generation account"); c != tc.runs {
+				t.Errorf("log of %d runs written, want %d:\n%s", c, tc.runs, out.String())
+			}
+		})
+	}
+	cfg := testConfig("http://127.0.0.1:1", g, l)
+	cfg.ReportOnlyChanged = true
+	if err := run(context.Background(), cfg); !errors.Is(err, errInvalidParameters) {
+		t.Errorf("run() without interval = %v, want %v", err, errInvalidParameters)
+	}
+}
+
+func TestWaitCreditedOverflow(t *testing.T) {
+	r := newTestAccount(t, "recipient")
+	// The balance is not requested when the expected balance can't be calculated
+	err := waitCredited(context.Background(), nil, r.addr, ^uint64(0), waves, trackOptions{})
+	if !errors.Is(err, errOverflow) {
+		t.Errorf("expected overflow error, got %v", err)
+	}
+}
+
+func TestProbeBlockAge(t *testing.T) {
+	g, l := newTestAccount(t, "generator"), newTestAccount(t, "lessor")
+	n, srv := newMockNode(t, g.addr)
+	n.blockAge = 10 * time.Minute
+	cfg := testConfig(srv.URL, g, l)
+	cfg.Probe = true
+	if err := run(context.Background(), cfg); err != nil {
+		t.Errorf("run() = %v, want nil without sync check", err)
+	}
+	cfg.MaxBlockAge = 3 * time.Minute
+	if err := run(context.Background(), cfg); !errors.Is(err, errFailure) {
+		t.Errorf("run() = %v, want %v for stale node", err, errFailure)
+	}
+	n.blockAge = 0
+	if err := run(context.Background(), cfg); err != nil {
+		t.Errorf("run() = %v, want nil for synchronized node", err)
+	}
+	if len(n.broadcasts) != 0 {
+		t.Errorf("%d transactions broadcasted by probe", len(n.broadcasts))
+	}
+}
+
+func TestRunUnwind(t *testing.T) {
+	g, l, r := newTestAccount(t, "generator"), newTestAccount(t, "lessor"), newTestAccount(t, "recipient")
+	n, srv := newMockNode(t, g.addr)
+	n.setBalance(l.addr, 2*waves)
+	lease := func(id byte, amount uint64) map[string]interface{} {
+		return map[string]interface{}{"id": testDigest(id).String(), "originTransactionId": testDigest(id).String(),
+			"sender": l.addr.String(), "recipient": r.addr.String(), "amount": float64(amount), "height": 10, "status": "active"}
+	}
+	n.leases = []map[string]interface{}{lease(1, 5*waves), lease(2, 3*waves)}
+	path := filepath.Join(t.TempDir(), "state.json")
+	st := new(state)
+	st.addLeaseNote(testDigest(1).String(), r.addr.String(), 5*waves, time.Hour)
+	if err := st.save(path); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig(srv.URL, g, l)
+	cfg.StateFile = path
+	cfg.Unwind = true
+	cfg.LessorFeeReserve = waves / 2
+	if err := run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() = %v, want nil", err)
+	}
+	if got := len(n.broadcasted(proto.LeaseCancelTransaction)); got != 2 {
+		t.Errorf("%d lease cancels, want 2", got)
+	}
+	transfers := n.broadcasted(proto.TransferTransaction)
+	if len(transfers) != 1 {
+		t.Fatalf("%d transfers, want 1", len(transfers))
+	}
+	// Freed balance minus cancel fees, irreducible balance, fee reserve and transfer fee
+	want := float64(10*waves - 2*standardFee - waves - waves/2 - standardFee)
+	if transfers[0]["amount"] != want || transfers[0]["recipient"] != g.addr.String() {
+		t.Errorf("unexpected withdrawal %v, want amount %v to generator", transfers[0], want)
+	}
+	st, err := loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.LeaseNotes) != 0 {
+		t.Errorf("notes of cancelled leases are kept: %v", st.LeaseNotes)
+	}
+}
+
+func TestRunCoalesceLeases(t *testing.T) {
+	g, l, r := newTestAccount(t, "generator"), newTestAccount(t, "lessor"), newTestAccount(t, "recipient")
+	n, srv := newMockNode(t, g.addr)
+	n.setBalance(g.addr, 2*waves+standardFee)
+	n.setBalance(l.addr, 2*waves)
+	for i, a := range []uint64{5 * waves, 3 * waves} {
+		id := testDigest(byte(i + 1)).String()
+		n.leases = append(n.leases, map[string]interface{}{"id": id, "originTransactionId": id,
+			"sender": l.addr.String(), "recipient": r.addr.String(), "amount": float64(a), "height": 10, "status": "active"})
+	}
+	cfg := testConfig(srv.URL, g, l)
+	cfg.CoalesceLeases = true
+	if err := run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() = %v, want nil", err)
+	}
+	if got := len(n.broadcasted(proto.LeaseCancelTransaction)); got != 2 {
+		t.Errorf("%d lease cancels, want 2", got)
+	}
+	leases := n.broadcasted(proto.LeaseTransaction)
+	// Transferred 1 WAVES and freed balance minus cancel fees, irreducible balance and lease fee
+	if want := float64(11*waves - 2*standardFee - waves - standardFee); len(leases) != 1 || leases[0]["amount"] != want {
+		t.Errorf("unexpected leases %v, want one of %v", leases, want)
+	}
+}
+
+func TestRunBulkBroadcast(t *testing.T) {
+	g, a, b := newTestAccount(t, "generator"), newTestAccount(t, "recipient a"), newTestAccount(t, "recipient b")
+	for _, bulk := range []bool{true, false} {
+		n, srv := newMockNode(t, g.addr)
+		n.bulk = bulk
+		n.setBalance(g.addr, waves+10*waves+2*standardFee)
+		cfg := testConfig(srv.URL, g, g)
+		cfg.LeasingAddress = a.addr.String() + ":9," + b.addr.String() + ":1"
+		cfg.BulkBroadcast = true
+		if err := run(context.Background(), cfg); err != nil {
+			t.Fatalf("bulk %t: run() = %v, want nil", bulk, err)
+		}
+		if got := len(n.broadcasted(proto.LeaseTransaction)); got != 2 {
+			t.Errorf("bulk %t: %d leases, want 2", bulk, got)
+		}
+		var requests int
+		for _, r := range n.requests {
+			if r == "POST /transactions/broadcast" {
+				requests++
+			}
+		}
+		// Rejected array is followed by broadcasting the leases one by one
+		if want := map[bool]int{true: 1, false: 3}[bulk]; requests != want {
+			t.Errorf("bulk %t: %d broadcast requests, want %d", bulk, requests, want)
+		}
+	}
+}
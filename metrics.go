@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// metrics collects counters of the tool to expose them in Prometheus text format.
+// Methods are safe to call on nil metrics, so nothing is collected if metrics are disabled.
+type metrics struct {
+	mu                 sync.Mutex
+	transfers          uint64
+	transferFailures   uint64
+	leases             uint64
+	leaseFailures      uint64
+	lastTransferAmount uint64
+	lastLeaseAmount    uint64
+	lastSuccess        time.Time
+}
+
+func (m *metrics) transferred(amount uint64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transfers++
+	m.lastTransferAmount = amount
+}
+
+func (m *metrics) transferFailed() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transferFailures++
+}
+
+func (m *metrics) leased(amount uint64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.leases++
+	m.lastLeaseAmount = amount
+}
+
+func (m *metrics) leaseFailed() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.leaseFailures++
+}
+
+func (m *metrics) succeeded() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastSuccess = time.Now()
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = fmt.Fprint(w, "# HELP waves_lessor_transfers_total Number of transfers to lessor by result.\n")
+	_, _ = fmt.Fprint(w, "# TYPE waves_lessor_transfers_total counter\n")
+	_, _ = fmt.Fprintf(w, "waves_lessor_transfers_total{result=\"success\"} %d\n", m.transfers)
+	_, _ = fmt.Fprintf(w, "waves_lessor_transfers_total{result=\"failure\"} %d\n", m.transferFailures)
+	_, _ = fmt.Fprint(w, "# HELP waves_lessor_leases_total Number of leases by result.\n")
+	_, _ = fmt.Fprint(w, "# TYPE waves_lessor_leases_total counter\n")
+	_, _ = fmt.Fprintf(w, "waves_lessor_leases_total{result=\"success\"} %d\n", m.leases)
+	_, _ = fmt.Fprintf(w, "waves_lessor_leases_total{result=\"failure\"} %d\n", m.leaseFailures)
+	_, _ = fmt.Fprint(w, "# HELP waves_lessor_last_transfer_amount_wavelets Amount of the last successful transfer.\n")
+	_, _ = fmt.Fprint(w, "# TYPE waves_lessor_last_transfer_amount_wavelets gauge\n")
+	_, _ = fmt.Fprintf(w, "waves_lessor_last_transfer_amount_wavelets %d\n", m.lastTransferAmount)
+	_, _ = fmt.Fprint(w, "# HELP waves_lessor_last_lease_amount_wavelets Amount of the last successful lease.\n")
+	_, _ = fmt.Fprint(w, "# TYPE waves_lessor_last_lease_amount_wavelets gauge\n")
+	_, _ = fmt.Fprintf(w, "waves_lessor_last_lease_amount_wavelets %d\n", m.lastLeaseAmount)
+	_, _ = fmt.Fprint(w, "# HELP waves_lessor_last_success_timestamp_seconds Time of the last successful run, 0 if none.\n")
+	_, _ = fmt.Fprint(w, "# TYPE waves_lessor_last_success_timestamp_seconds gauge\n")
+	var ts int64
+	if !m.lastSuccess.IsZero() {
+		ts = m.lastSuccess.Unix()
+	}
+	_, _ = fmt.Fprintf(w, "waves_lessor_last_success_timestamp_seconds %d\n", ts)
+}
+
+// serveMetrics starts HTTP server exposing metrics on /metrics path. The returned function stops the server.
+func serveMetrics(addr string, m *metrics) (func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[WARN] Metrics server failed: %v", err)
+		}
+	}()
+	log.Printf("[INFO] Serving metrics on 'http://%s/metrics'", ln.Addr().String())
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("[WARN] Failed to stop metrics server: %v", err)
+		}
+	}, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/wavesplatform/gowaves/pkg/proto"
+)
+
+const (
+	minGeneratingBalance uint64 = 1000 * waves
+	recentBlocksDepth    uint64 = 100
+)
+
+func countGeneratedBlocks(ctx context.Context, cl *node, addr proto.WavesAddress, depth uint64) (int, error) {
+	generators, err := recentGenerators(ctx, cl, depth)
+	if err != nil {
+		return 0, err
+	}
+	return generators[addr], nil
+}
+
+// recentGenerators returns the number of blocks produced by each generator among the given number of last blocks.
+func recentGenerators(ctx context.Context, cl *node, depth uint64) (map[proto.WavesAddress]int, error) {
+	h, _, err := cl.Blocks.Height(ctx)
+	if err != nil {
+		return nil, err
+	}
+	from := uint64(1)
+	if h.Height > depth {
+		from = h.Height - depth + 1
+	}
+	headers, _, err := cl.Blocks.HeadersSeq(ctx, from, h.Height)
+	if err != nil {
+		return nil, err
+	}
+	r := make(map[proto.WavesAddress]int)
+	for _, hdr := range headers {
+		r[hdr.Generator]++
+	}
+	return r, nil
+}
+
+func getGeneratingBalance(ctx context.Context, cl *node, addr proto.WavesAddress) (uint64, error) {
+	ab, err := getBalanceDetails(ctx, cl, addr)
+	if err != nil {
+		return 0, err
+	}
+	return ab.Generating, nil
+}
+
+// reportMiningEligibility logs whether the recipient's generating balance with the lease amount added reaches
+// the minimal balance to mine. The new lease counts in generating balance only after 1000 blocks.
+func (c *cycle) reportMiningEligibility(ctx context.Context, rcp proto.Recipient, amount uint64) error {
+	addr, err := c.resolve(ctx, rcp)
+	if err != nil {
+		return err
+	}
+	gb, err := getGeneratingBalance(ctx, c.cl, addr)
+	if err != nil {
+		return err
+	}
+	if c.dryRun { // Leases are not cancelled in dry-run, so their amounts are still in the generating balance
+		for _, l := range c.sum.cancels {
+			if l.Recipient == rcp.String() || l.Recipient == addr.String() {
+				gb = deduct(gb, l.Amount)
+			}
+		}
+	}
+	projected := gb + amount
+	explainf("Generating balance of '%s' %s plus lease amount %s is %s", addr.String(), format(gb), format(amount), format(projected))
+	if projected < minGeneratingBalance {
+		log.Printf("[WARN] Generating balance of '%s' will be %s after the lease, below %s required to mine",
+			addr.String(), format(projected), format(minGeneratingBalance))
+		return nil
+	}
+	log.Printf("[INFO] Generating balance of '%s' will be %s after the lease, enough to mine", addr.String(), format(projected))
+	return nil
+}
+
+// reportRecentMining warns about the lease recipients that produced no blocks recently,
+// the lease to a node that doesn't mine brings no rewards.
+func (c *cycle) reportRecentMining(ctx context.Context, recipients []proto.Recipient) error {
+	generators, err := recentGenerators(ctx, c.cl, recentBlocksDepth)
+	if err != nil {
+		return err
+	}
+	for _, rcp := range recipients {
+		addr, err := c.resolve(ctx, rcp)
+		if err != nil {
+			return err
+		}
+		n := generators[addr]
+		if n == 0 {
+			log.Printf("[WARN] Leasing address '%s' produced none of last %d blocks, it may be not an active mining node",
+				addr.String(), recentBlocksDepth)
+			continue
+		}
+		log.Printf("[INFO] Leasing address '%s' produced %d of last %d blocks", addr.String(), n, recentBlocksDepth)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+const (
+	levelDebug = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levels = map[string]int{
+	"debug":   levelDebug,
+	"info":    levelInfo,
+	"explain": levelInfo,
+	"warn":    levelWarn,
+	"error":   levelError,
+}
+
+var (
+	output      = outputText
+	minLevel    = levelInfo
+	showExplain = false
+	events      *jsonWriter
+)
+
+type fields map[string]interface{}
+
+// levelWriter drops log lines with level below the minimal one.
+type levelWriter struct {
+	out io.Writer
+}
+
+func (w *levelWriter) Write(p []byte) (int, error) {
+	s := string(p)
+	if i := strings.IndexByte(s, '['); i >= 0 {
+		s = s[i:]
+	}
+	if level, _ := splitLevel(s); !enabled(level) {
+		return len(p), nil
+	}
+	return w.out.Write(p)
+}
+
+func enabled(level string) bool {
+	if level == "explain" && !showExplain {
+		return false
+	}
+	l, ok := levels[level]
+	return !ok || l >= minLevel
+}
+
+// jsonWriter turns log lines with level prefix like "[INFO] " into JSON objects, one per line.
+type jsonWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (w *jsonWriter) Write(p []byte) (int, error) {
+	level, msg := splitLevel(strings.TrimRight(string(p), "\n"))
+	if err := w.write(level, msg, nil); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *jsonWriter) write(level, msg string, f fields) error {
+	e := make(map[string]interface{}, len(f)+3)
+	for k, v := range f {
+		e[k] = v
+	}
+	e["time"] = time.Now().Format(time.RFC3339Nano)
+	e["level"] = level
+	e["msg"] = msg
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err = w.out.Write(append(b, '\n'))
+	return err
+}
+
+func splitLevel(s string) (string, string) {
+	if strings.HasPrefix(s, "[") {
+		if i := strings.Index(s, "] "); i > 0 {
+			return strings.ToLower(s[1:i]), s[i+2:]
+		}
+	}
+	return "info", s
+}
+
+// setupOutput configures the standard logger, the configuration is process-wide.
+func setupOutput(format, level string, explain bool, out io.Writer) error {
+	l, ok := levels[level]
+	if !ok || level == "explain" {
+		return fmt.Errorf("unsupported log level '%s'", level)
+	}
+	switch format {
+	case outputText:
+	case outputJSON:
+		log.SetFlags(0)
+		events = &jsonWriter{out: out}
+		out = events
+	default:
+		return fmt.Errorf("unsupported output format '%s'", format)
+	}
+	log.SetOutput(&levelWriter{out: out})
+	output = format
+	minLevel = l
+	showExplain = explain
+	return nil
+}
+
+// logWith logs the message as usual, but in JSON output mode the given fields are added to the event.
+func logWith(f fields, format string, args ...interface{}) {
+	if output == outputJSON && events != nil {
+		level, msg := splitLevel(fmt.Sprintf(format, args...))
+		if !enabled(level) {
+			return
+		}
+		if err := events.write(level, msg, f); err != nil {
+			log.Printf("[ERROR] Failed to write log event: %v", err)
+		}
+		return
+	}
+	log.Printf(format, args...)
+}
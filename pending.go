@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/wavesplatform/gowaves/pkg/crypto"
+)
+
+// isKnown checks that transaction is on blockchain or in node's UTX pool.
+func isKnown(ctx context.Context, cl *node, id crypto.Digest) (bool, error) {
+	if cl.grpc != nil {
+		return cl.grpc.known(ctx, id)
+	}
+	_, err := getTransactionStatus(ctx, cl, id)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, errNotFound) {
+		return false, err
+	}
+	_, resp, err := cl.Transactions.UnconfirmedInfo(ctx, id)
+	if err != nil {
+		if resp != nil && resp.Response != nil && resp.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// resumePending continues tracking of transactions left unconfirmed by the interrupted run.
+// Transactions that are neither on blockchain nor in UTX pool, failed or not confirmed in time are dropped
+// from the state, only transient errors of node keep them for the next run.
+// Returns the kinds of transactions that were resumed.
+func (c *cycle) resumePending(ctx context.Context) (map[string]bool, error) {
+	resumed := make(map[string]bool)
+	if c.st == nil {
+		return resumed, nil
+	}
+	pending := append(c.st.pendingOf(c.gAddr.String()), c.st.pendingOf(c.lAddr.String())...)
+	for _, p := range pending {
+		id, err := crypto.NewDigestFromBase58(p.TxID)
+		if err != nil {
+			log.Printf("[WARN] Invalid ID of pending %s transaction '%s' in state: %v", p.Kind, p.TxID, err)
+			c.st.removePending(p.TxID)
+			continue
+		}
+		known, err := isKnown(ctx, c.cl, id)
+		if err != nil {
+			return nil, err
+		}
+		if !known {
+			log.Printf("[WARN] Pending %s transaction '%s' of %s is not found on node, it is dropped", p.Kind, p.TxID, format(p.Amount))
+			c.st.dropPending(p.TxID)
+			continue
+		}
+		log.Printf("[INFO] Resuming tracking of %s transaction '%s' of %s broadcasted by previous run", p.Kind, p.TxID, format(p.Amount))
+		if err := track(ctx, c.cl, id, c.tracking); err != nil {
+			switch {
+			case errors.Is(err, errTxFailed) || errors.Is(err, errRolledBack):
+				log.Printf("[WARN] Pending %s transaction '%s' of %s failed, it is dropped: %v", p.Kind, p.TxID, format(p.Amount), err)
+				c.st.dropPending(p.TxID)
+			case errors.Is(err, errConfirmationTimeout): // It still may be confirmed, so the amount is kept as spent
+				log.Printf("[WARN] Pending %s transaction '%s' of %s is not confirmed in time, it is dropped", p.Kind, p.TxID, format(p.Amount))
+				c.st.removePending(p.TxID)
+			default:
+				return nil, err
+			}
+			continue
+		}
+		c.st.removePending(p.TxID)
+		resumed[p.Kind] = true
+	}
+	if len(pending) > 0 {
+		if err := c.saveState(); err != nil {
+			return nil, err
+		}
+	}
+	return resumed, nil
+}
+
+// confirmPending removes the confirmed transaction from pending ones in the state.
+func (c *cycle) confirmPending(id string) error {
+	if c.st == nil {
+		return nil
+	}
+	c.st.removePending(id)
+	return c.saveState()
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wavesplatform/gowaves/pkg/crypto"
+	g "github.com/wavesplatform/gowaves/pkg/grpc/generated/waves/node/grpc"
+	"github.com/wavesplatform/gowaves/pkg/proto"
+	"google.golang.org/grpc"
+)
+
+const testTxID = "8k7GUAb8eSLZVgRpfbJ1jroz8WxMpUAGuzd217y4FDFp"
+
+func TestResumeFailedPendingTransfer(t *testing.T) {
+	g, l := newTestAccount(t, "generator"), newTestAccount(t, "lessor")
+	n, srv := newMockNode(t, g.addr)
+	n.setBalance(g.addr, 10*waves)
+	n.broadcasts = []map[string]interface{}{{"id": testTxID, "type": float64(proto.TransferTransaction)}}
+	n.statuses = map[string]string{testTxID: "script_execution_failed"}
+	path := filepath.Join(t.TempDir(), "state.json")
+	st := new(state)
+	st.addSpending("transfer", testTxID, 5*waves)
+	st.addPending("transfer", testTxID, g.addr.String(), 10*waves, 5*waves)
+	if err := st.save(path); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig(srv.URL, g, l)
+	cfg.StateFile = path
+	cfg.MaxAmountPerDay = 20 * waves
+	for i := 0; i < 2; i++ { // The failed transaction must not block the next runs
+		if err := run(context.Background(), cfg); err != nil {
+			t.Fatalf("run #%d = %v, want nil", i+1, err)
+		}
+	}
+	st, err := loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range st.Pending {
+		if p.TxID == testTxID {
+			t.Errorf("failed transaction '%s' is still pending", testTxID)
+		}
+	}
+	for _, s := range st.Spendings {
+		if s.TxID == testTxID {
+			t.Errorf("amount of failed transaction '%s' is counted as spent", testTxID)
+		}
+	}
+	if got := len(n.broadcasted(proto.TransferTransaction)); got != 2 {
+		t.Errorf("%d transfers, want the preloaded one and a new one", got)
+	}
+}
+
+func TestResumedLeaseSkipsNewLease(t *testing.T) {
+	gen, l := newTestAccount(t, "generator"), newTestAccount(t, "lessor")
+	n, srv := newMockNode(t, gen.addr)
+	n.setBalance(gen.addr, 10*waves)
+	n.broadcasts = []map[string]interface{}{{"id": testTxID, "type": float64(proto.LeaseTransaction)}}
+	path := filepath.Join(t.TempDir(), "state.json")
+	st := new(state)
+	st.addSpending("lease", testTxID, 5*waves)
+	st.addPending("lease", testTxID, l.addr.String(), 0, 5*waves)
+	if err := st.save(path); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig(srv.URL, gen, l)
+	cfg.StateFile = path
+	if err := run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() = %v, want nil", err)
+	}
+	if got := len(n.broadcasted(proto.LeaseTransaction)); got != 1 {
+		t.Errorf("%d leases, want only the resumed one", got)
+	}
+	if got := len(n.broadcasted(proto.TransferTransaction)); got != 1 {
+		t.Errorf("%d transfers, want 1", got)
+	}
+}
+
+type testTransactionsServer struct {
+	g.UnimplementedTransactionsApiServer
+	statuses map[crypto.Digest]g.TransactionStatus_Status
+}
+
+func (s *testTransactionsServer) GetStatuses(req *g.TransactionsByIdRequest, stream g.TransactionsApi_GetStatusesServer) error {
+	for _, b := range req.TransactionIds {
+		id, err := crypto.NewDigestFromBytes(b)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&g.TransactionStatus{Id: b, Status: s.statuses[id]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestIsKnownGRPC(t *testing.T) {
+	ts := &testTransactionsServer{statuses: map[crypto.Digest]g.TransactionStatus_Status{
+		testDigest(1): g.TransactionStatus_CONFIRMED,
+		testDigest(2): g.TransactionStatus_UNCONFIRMED,
+		testDigest(3): g.TransactionStatus_NOT_EXISTS,
+	}}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	g.RegisterTransactionsApiServer(srv, ts)
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+	gn, err := dialGRPC(lis.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gn.close()
+
+	for id, want := range map[byte]bool{1: true, 2: true, 3: false} {
+		known, err := isKnown(context.Background(), &node{grpc: gn}, testDigest(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if known != want {
+			t.Errorf("isKnown(%s) = %t, want %t", testDigest(id).String(), known, want)
+		}
+	}
+}
+
+func TestPendingSavedBeforeBroadcast(t *testing.T) {
+	g, l := newTestAccount(t, "generator"), newTestAccount(t, "lessor")
+	n, srv := newMockNode(t, g.addr)
+	n.setBalance(g.addr, 10*waves)
+	path := filepath.Join(t.TempDir(), "state.json")
+	n.onBroadcast = func(tx map[string]interface{}) {
+		st, err := loadState(path)
+		if err != nil {
+			t.Errorf("failed to load state: %v", err)
+			return
+		}
+		for _, p := range st.Pending {
+			if p.TxID == tx["id"] {
+				return
+			}
+		}
+		t.Errorf("transaction '%v' is broadcasted before it's saved as pending", tx["id"])
+	}
+	cfg := testConfig(srv.URL, g, l)
+	cfg.StateFile = path
+	if err := run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() = %v, want nil", err)
+	}
+	if len(n.broadcasts) != 2 {
+		t.Errorf("%d transactions broadcasted, want transfer and lease", len(n.broadcasts))
+	}
+}
+
+func TestDailyBudgetCountsTransferAndLeaseSeparately(t *testing.T) {
+	g, l := newTestAccount(t, "generator"), newTestAccount(t, "lessor")
+	n, srv := newMockNode(t, g.addr)
+	n.setBalance(g.addr, 10*waves)
+	path := filepath.Join(t.TempDir(), "state.json")
+	cfg := testConfig(srv.URL, g, l)
+	cfg.StateFile = path
+	cfg.MaxAmountPerDay = 20 * waves
+	if err := run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() = %v, want nil", err)
+	}
+	transfers, leases := n.broadcasted(proto.TransferTransaction), n.broadcasted(proto.LeaseTransaction)
+	if len(transfers) != 1 || len(leases) != 1 {
+		t.Fatalf("%d transfers and %d leases, want 1 of each", len(transfers), len(leases))
+	}
+	st, err := loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for kind, tx := range map[string]map[string]interface{}{"transfer": transfers[0], "lease": leases[0]} {
+		want := 20*waves - uint64(tx["amount"].(float64))
+		if got := st.dailyBudget(kind, 20*waves); got != want {
+			t.Errorf("remaining daily budget of %s is %d, want %d", kind, got, want)
+		}
+	}
+}
+
+func TestDryRunKeepsStateFile(t *testing.T) {
+	g, l := newTestAccount(t, "generator"), newTestAccount(t, "lessor")
+	n, srv := newMockNode(t, g.addr)
+	n.setBalance(g.addr, 10*waves)
+	path := filepath.Join(t.TempDir(), "state.json")
+	st := new(state)
+	// Pending transaction unknown to node and expired note of inactive lease are dropped by a real run
+	st.addSpending("transfer", testTxID, 5*waves)
+	st.addPending("transfer", testTxID, g.addr.String(), 10*waves, 5*waves)
+	st.addLeaseNote(testBlockID, l.addr.String(), waves, -time.Hour)
+	if err := st.save(path); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig(srv.URL, g, l)
+	cfg.StateFile = path
+	cfg.MaxAmountPerDay = 20 * waves
+	cfg.LeaseNoteExpiry = time.Hour
+	cfg.DryRun = true
+	if err := run(context.Background(), cfg); err != nil {
+		t.Fatalf("run() = %v, want nil", err)
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Errorf("state file is changed by dry-run:\nbefore %s\nafter  %s", before, after)
+	}
+}
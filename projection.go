@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/wavesplatform/gowaves/pkg/proto"
+)
+
+type balanceDelta struct {
+	regular   int64
+	available int64
+	effective int64
+}
+
+func applyDelta(v uint64, d int64) uint64 {
+	if d < 0 {
+		return deduct(v, uint64(-d))
+	}
+	return v + uint64(d)
+}
+
+func (c *cycle) resolve(ctx context.Context, rcp proto.Recipient) (proto.WavesAddress, error) {
+	if rcp.Address != nil {
+		return *rcp.Address, nil
+	}
+	addr, _, err := c.cl.Alias.Get(ctx, rcp.Alias.Alias)
+	return addr, err
+}
+
+// projectBalances logs balances of involved accounts as they would be after the transactions of dry-run.
+// Generating balance is not projected because it follows the effective balance only after 1000 blocks.
+func (c *cycle) projectBalances(ctx context.Context) {
+	s := c.sum
+	if s.transferID == "" && len(s.leases) == 0 && len(s.cancels) == 0 {
+		return
+	}
+	var accounts []proto.WavesAddress
+	deltas := make(map[proto.WavesAddress]*balanceDelta)
+	account := func(addr proto.WavesAddress) *balanceDelta {
+		d, ok := deltas[addr]
+		if !ok {
+			d = new(balanceDelta)
+			deltas[addr] = d
+			accounts = append(accounts, addr)
+		}
+		return d
+	}
+	g := account(c.gAddr)
+	l := account(c.lAddr)
+	if s.transferID != "" {
+		out := int64(s.transferAmount + s.transferFee)
+		g.regular -= out
+		g.available -= out
+		g.effective -= out
+		in := int64(s.transferAmount)
+		l.regular += in
+		l.available += in
+		l.effective += in
+	}
+	for _, cn := range s.cancels {
+		l.regular -= int64(cn.fee)
+		l.available += int64(cn.Amount) - int64(cn.fee)
+		l.effective += int64(cn.Amount) - int64(cn.fee)
+		addr, err := c.resolve(ctx, cn.rcp)
+		if err != nil {
+			log.Printf("[WARN] Failed to resolve recipient '%s' for balance projection: %v", cn.Recipient, err)
+			continue
+		}
+		account(addr).effective -= int64(cn.Amount)
+	}
+	for _, ls := range s.leases {
+		l.regular -= int64(ls.fee)
+		l.available -= int64(ls.Amount + ls.fee)
+		l.effective -= int64(ls.Amount + ls.fee)
+		addr, err := c.resolve(ctx, ls.rcp)
+		if err != nil {
+			log.Printf("[WARN] Failed to resolve recipient '%s' for balance projection: %v", ls.Recipient, err)
+			continue
+		}
+		account(addr).effective += int64(ls.Amount)
+	}
+	log.Print("[INFO] DRY-RUN: Projected balances after the transactions:")
+	for _, addr := range accounts {
+		ab, err := getBalanceDetails(ctx, c.cl, addr)
+		if err != nil {
+			log.Printf("[WARN] Failed to get balance of '%s' for projection: %v", addr.String(), err)
+			continue
+		}
+		role := "recipient"
+		switch addr {
+		case c.gAddr:
+			role = "generator"
+		case c.lAddr:
+			role = "lessor"
+		}
+		d := deltas[addr]
+		regular := applyDelta(ab.Regular, d.regular)
+		available := applyDelta(ab.Available, d.available)
+		effective := applyDelta(ab.Effective, d.effective)
+		logWith(fields{"address": addr.String(), "role": role, "regular": regular, "available": available, "effective": effective},
+			"[INFO] DRY-RUN:   %s '%s': regular %s -> %s, available %s -> %s, effective %s -> %s", role, addr.String(),
+			format(ab.Regular), format(regular), format(ab.Available), format(available), format(ab.Effective), format(effective))
+	}
+	logWith(fields{"fees": s.fees}, "[INFO] DRY-RUN:   Total fees: %s", format(s.fees))
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/wavesplatform/gowaves/pkg/proto"
+)
+
+var stdin = bufio.NewReader(os.Stdin)
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmBroadcast shows the transaction and asks the user to confirm its broadcast, anything but 'y' is a refusal.
+func confirmBroadcast(ctx context.Context, tx proto.Transaction) (bool, error) {
+	b, err := json.MarshalIndent(tx, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	fmt.Fprintf(os.Stderr, "%s\nProceed? [y/N] ", string(b))
+	answer := make(chan string, 1)
+	go func() {
+		s, _ := stdin.ReadString('\n')
+		answer <- s
+	}()
+	select {
+	case <-ctx.Done():
+		fmt.Fprintln(os.Stderr)
+		return false, ctx.Err()
+	case s := <-answer:
+		s = strings.ToLower(strings.TrimSpace(s))
+		return s == "y" || s == "yes", nil
+	}
+}
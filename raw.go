@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/wavesplatform/gowaves/pkg/proto"
+)
+
+var rawFormats = map[string]bool{"hex": true, "base64": true, "binary": true}
+
+// writeRaw appends signed transaction bytes to the file. Transactions of version 2 are serialized in legacy binary
+// format, transactions of version 3 are serialized as signed Protobuf messages. Hex and Base64 encoded transactions
+// are written one per line, binary transactions are prefixed with their length as 4 bytes big-endian integer.
+func writeRaw(path, format string, scheme proto.Scheme, tx proto.Transaction) error {
+	b, err := proto.MarshalTx(scheme, tx)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	switch format {
+	case "hex":
+		data = []byte(hex.EncodeToString(b) + "\n")
+	case "base64":
+		data = []byte(base64.StdEncoding.EncodeToString(b) + "\n")
+	case "binary":
+		data = make([]byte, 4+len(b))
+		binary.BigEndian.PutUint32(data, uint32(len(b)))
+		copy(data[4:], b)
+	default:
+		return fmt.Errorf("unsupported raw format '%s'", format)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
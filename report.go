@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reportHeartbeat is the longest time without a line in the log while the outcome of repeated runs doesn't change.
+const reportHeartbeat = time.Hour
+
+// changeReporter holds back the log of a repeated run and drops it if the run did nothing and its outcome is the same
+// as the previous one. Warnings and errors are written at once together with the held lines before them.
+type changeReporter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	json    bool // Lines are JSON events
+	held    bytes.Buffer
+	pass    bool   // Lines are written at once
+	outcome string // Outcome of the previous run
+	skipped int    // Runs dropped since the last written one
+	last    time.Time
+}
+
+// installChangeReporter puts the reporter in front of the log output and returns the function that writes
+// the held lines and removes it.
+func installChangeReporter() (*changeReporter, func()) {
+	r := &changeReporter{pass: true, last: time.Now()}
+	if events != nil { // Log lines and events with fields all end up in events writer
+		r.out, r.json = events.out, true
+		events.out = r
+		return r, func() { r.close(); events.out = r.out }
+	}
+	r.out = log.Writer()
+	log.SetOutput(r)
+	return r, func() { r.close(); log.SetOutput(r.out) }
+}
+
+func (r *changeReporter) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.held.Len() > 0 {
+		_ = r.flush()
+	}
+	r.pass = true
+}
+
+func (r *changeReporter) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.pass {
+		if l := r.level(p); l != "warn" && l != "error" {
+			return r.held.Write(p)
+		}
+		if err := r.flush(); err != nil {
+			return 0, err
+		}
+		r.pass = true
+	}
+	return r.out.Write(p)
+}
+
+func (r *changeReporter) level(p []byte) string {
+	if r.json {
+		var e struct {
+			Level string `json:"level"`
+		}
+		_ = json.Unmarshal(p, &e)
+		return e.Level
+	}
+	s := string(p)
+	if i := strings.IndexByte(s, '['); i >= 0 {
+		s = s[i:]
+	}
+	l, _ := splitLevel(s)
+	return l
+}
+
+func (r *changeReporter) flush() error {
+	_, err := r.out.Write(r.held.Bytes())
+	r.held.Reset()
+	r.skipped = 0
+	r.last = time.Now()
+	return err
+}
+
+// begin starts holding back the log of a run.
+func (r *changeReporter) begin() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pass = false
+}
+
+// end writes the held log of the run if the run made transactions or its outcome differs from the previous one.
+// Otherwise the log is dropped and the heartbeat line is written from time to time.
+func (r *changeReporter) end(outcome string, acted bool) {
+	r.mu.Lock()
+	changed := acted || r.pass || outcome != r.outcome
+	r.outcome = outcome
+	if changed {
+		if err := r.flush(); err != nil {
+			r.mu.Unlock()
+			log.Printf("[ERROR] Failed to write log: %v", err)
+			return
+		}
+	} else {
+		r.held.Reset()
+		r.skipped++
+	}
+	r.pass = true
+	heartbeat := !changed && time.Since(r.last) >= reportHeartbeat
+	skipped := r.skipped
+	r.mu.Unlock()
+	if heartbeat {
+		log.Printf("[INFO] Nothing changed in %d runs since the last report", skipped)
+		r.mu.Lock()
+		r.skipped, r.last = 0, time.Now()
+		r.mu.Unlock()
+	}
+}
+
+// cyclesOutcome describes the outcome of the runs of cycles and reports whether any transaction was made.
+func cyclesOutcome(cycles []*cycle, err error) (string, bool) {
+	var acted bool
+	for _, c := range cycles {
+		if c.sum != nil && (c.sum.transferID != "" || len(c.sum.leases) > 0 || len(c.sum.cancels) > 0) {
+			acted = true
+		}
+	}
+	return fmt.Sprint(err), acted
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChangeReporter(t *testing.T) {
+	var out bytes.Buffer
+	r := &changeReporter{out: &out, pass: true, last: time.Now()}
+	write := func(s string) {
+		if _, err := r.Write([]byte(s + "\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func(lines []string, outcome string, acted bool) string {
+		out.Reset()
+		r.begin()
+		for _, l := range lines {
+			write(l)
+		}
+		r.end(outcome, acted)
+		return out.String()
+	}
+	noop := []string{"2026/01/01 00:00:00 [INFO] Balance is 1 WAVES", "2026/01/01 00:00:00 [INFO] Nothing to lease"}
+
+	if s := run(noop, "<nil>", false); !strings.Contains(s, "Nothing to lease") {
+		t.Errorf("log of the first run is dropped: %q", s)
+	}
+	if s := run(noop, "<nil>", false); s != "" {
+		t.Errorf("log of the same no-op run is written: %q", s)
+	}
+	if s := run(noop, "<nil>", true); !strings.Contains(s, "Nothing to lease") {
+		t.Errorf("log of the run with transactions is dropped: %q", s)
+	}
+	if s := run(noop, "failure", false); !strings.Contains(s, "Nothing to lease") {
+		t.Errorf("log of the run with another outcome is dropped: %q", s)
+	}
+	s := run(append(noop, "2026/01/01 00:00:00 [WARN] Balance is below alert threshold"), "failure", false)
+	if !strings.HasPrefix(s, noop[0]) || !strings.Contains(s, "[WARN]") {
+		t.Errorf("warning is not written with the lines before it: %q", s)
+	}
+	r.last = time.Now().Add(-reportHeartbeat)
+	if s := run(noop, "failure", false); strings.Contains(s, "Nothing to lease") {
+		t.Errorf("log of the same no-op run is written: %q", s)
+	}
+	if r.skipped != 0 || time.Since(r.last) > time.Minute {
+		t.Errorf("heartbeat is not made after %s", reportHeartbeat)
+	}
+
+	out.Reset()
+	r = &changeReporter{out: &out, json: true}
+	r.begin()
+	write(`{"level":"info","msg":"Nothing to lease"}`)
+	if out.Len() != 0 {
+		t.Errorf("info event is not held: %q", out.String())
+	}
+	write(`{"level":"error","msg":"Failed"}`)
+	if c := strings.Count(out.String(), "\n"); c != 2 {
+		t.Errorf("%d events written on error, want 2: %q", c, out.String())
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wavesplatform/gowaves/pkg/client"
+)
+
+const (
+	initialRetryDelay = 500 * time.Millisecond
+	maxRetryAfter     = time.Minute
+)
+
+// isTransient reports whether the request failed on network level, was rate limited or the node responded with server error.
+// Errors reported by the node about the request itself, like insufficient fee, are not transient.
+func isTransient(resp *client.Response, err error) bool {
+	if isTransientGRPC(err) {
+		return true
+	}
+	var re *client.RequestError
+	if !errors.As(err, &re) {
+		return false
+	}
+	if resp == nil || resp.Response == nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// retryAfter returns the delay requested by the node in Retry-After header of 429 response, capped by maxRetryAfter.
+// Zero is returned if the response is not rate limited or the header is missing or invalid.
+func retryAfter(resp *client.Response) time.Duration {
+	if resp == nil || resp.Response == nil || resp.StatusCode != http.StatusTooManyRequests {
+		return 0
+	}
+	v := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	var d time.Duration
+	if s, err := strconv.Atoi(v); err == nil {
+		d = time.Duration(s) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = time.Until(t)
+	}
+	if d <= 0 {
+		return 0
+	}
+	if d > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return d
+}
+
+// isAlreadyInState reports whether the node rejected the transaction because the same transaction
+// is already in the blockchain state.
+func isAlreadyInState(err error) bool {
+	var re *client.RequestError
+	if !errors.As(err, &re) {
+		return isGRPCError(err) && strings.Contains(err.Error(), "already in the state")
+	}
+	return strings.Contains(re.Body, "already in the state")
+}
+
+// retry calls f until it succeeds, fails with non-transient error or the number of retries is exhausted.
+// The delay between attempts doubles starting from initialRetryDelay, unless the node asks to wait with Retry-After header.
+func retry(ctx context.Context, retries int, what string, f func() (*client.Response, error)) error {
+	delay := initialRetryDelay
+	for i := 0; ; i++ {
+		resp, err := f()
+		if err == nil || i >= retries || !isTransient(resp, err) {
+			return err
+		}
+		wait := delay
+		if d := retryAfter(resp); d > 0 {
+			wait = d
+		}
+		log.Printf("[WARN] Failed to %s, retrying in %s (%d of %d): %v", what, wait, i+1, retries, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
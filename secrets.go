@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/wavesplatform/gowaves/pkg/crypto"
+)
+
+const (
+	execProviderPrefix = "exec://"
+	fileProviderPrefix = "file://"
+)
+
+type secretProvider interface {
+	fetch(ctx context.Context) ([]byte, error)
+}
+
+// execProvider runs the command and takes its standard output as a secret.
+type execProvider struct {
+	name string
+	args []string
+}
+
+func (p *execProvider) fetch(ctx context.Context) ([]byte, error) {
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.name, p.args...)
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		zero(out.Bytes())
+		return nil, fmt.Errorf("command '%s' failed: %w", p.name, err)
+	}
+	return out.Bytes(), nil
+}
+
+// fileProvider takes the first line of the file as a secret.
+type fileProvider struct {
+	path string
+}
+
+func (p *fileProvider) fetch(_ context.Context) ([]byte, error) {
+	b, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, err
+	}
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		zero(b[i:])
+		b = b[:i]
+	}
+	return b, nil
+}
+
+// seedProvider derives the private key from the seed phrase the same way as Waves wallets do.
+// The account seed is the secure hash of the nonce as 4 bytes big-endian integer followed by the seed phrase bytes,
+// the private key is generated from SHA-256 hash of the account seed. Nonce 0 gives the first account of a seed.
+type seedProvider struct {
+	seed  string
+	nonce uint32
+}
+
+func (p *seedProvider) fetch(_ context.Context) ([]byte, error) {
+	b := make([]byte, 4+len(p.seed))
+	defer zero(b)
+	binary.BigEndian.PutUint32(b, p.nonce)
+	copy(b[4:], p.seed)
+	as, err := crypto.SecureHash(b)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(as[:])
+	sk, _, err := crypto.GenerateKeyPair(as[:])
+	if err != nil {
+		return nil, err
+	}
+	defer zero(sk[:])
+	return []byte(sk.String()), nil
+}
+
+// secretList is a repeatable flag of secrets, its values are never shown.
+type secretList []string
+
+func (l *secretList) String() string {
+	return ""
+}
+
+func (l *secretList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+func newSecretProvider(ref string) (secretProvider, error) {
+	switch {
+	case strings.HasPrefix(ref, fileProviderPrefix):
+		path := strings.TrimPrefix(ref, fileProviderPrefix)
+		if path == "" {
+			return nil, errors.New("empty file path")
+		}
+		return &fileProvider{path: path}, nil
+	case strings.HasPrefix(ref, execProviderPrefix):
+		f := strings.Fields(strings.TrimPrefix(ref, execProviderPrefix))
+		if len(f) == 0 {
+			return nil, errors.New("empty command")
+		}
+		return &execProvider{name: f[0], args: f[1:]}, nil
+	default:
+		return nil, fmt.Errorf("unsupported secret provider '%s'", ref)
+	}
+}
+
+// selectSKProvider checks that only one source of private key is given. No provider is returned for inline key.
+// Explicitly given flags take precedence over environment variables, so inline key may come from environment.
+func selectSKProvider(inline, file, ref, seed string, nonce uint32, ks *keystoreProvider) (secretProvider, error) {
+	n := 0
+	for _, v := range []string{inline, file, ref, seed} {
+		if v != "" {
+			n++
+		}
+	}
+	if ks != nil {
+		n++
+	}
+	switch {
+	case n == 0:
+		return nil, errors.New("no key is given")
+	case n > 1:
+		return nil, errors.New("key is given in more than one way")
+	case file != "":
+		return &fileProvider{path: file}, nil
+	case ref != "":
+		return newSecretProvider(ref)
+	case seed != "":
+		return &seedProvider{seed: seed, nonce: nonce}, nil
+	case ks != nil:
+		return ks, nil
+	default:
+		if len(strings.Fields(inline)) > 1 {
+			return nil, errors.New("invalid key")
+		}
+		return nil, nil
+	}
+}
+
+func fetchSK(ctx context.Context, p secretProvider) (crypto.SecretKey, error) {
+	b, err := p.fetch(ctx)
+	if err != nil {
+		return crypto.SecretKey{}, err
+	}
+	defer zero(b)
+	return crypto.NewSecretKeyFromBase58(string(bytes.TrimSpace(b)))
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
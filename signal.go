@@ -0,0 +1,10 @@
+package main
+
+import (
+	"context"
+	"os/signal"
+)
+
+func interruptListener(ctx context.Context) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(ctx, interruptSignals...)
+}
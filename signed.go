@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/wavesplatform/gowaves/pkg/crypto"
+	"github.com/wavesplatform/gowaves/pkg/proto"
+)
+
+// writeSigned appends signed transaction to the file as JSON, one transaction per line.
+func writeSigned(path string, tx proto.Transaction) error {
+	b, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readSigned reads transactions written by writeSigned, empty lines are skipped.
+func readSigned(path string) ([]proto.Transaction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var txs []proto.Transaction
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; s.Scan(); n++ {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		tv := new(proto.TransactionTypeVersion)
+		if err := json.Unmarshal(line, tv); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		tx, err := proto.GuessTransactionType(tv)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if err := json.Unmarshal(line, tx); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		txs = append(txs, tx)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+func broadcastSigned(ctx context.Context, cl *node, scheme proto.Scheme, path string, retries int, opts trackOptions) error {
+	txs, err := readSigned(path)
+	if err != nil {
+		log.Printf("[ERROR] Failed to read signed transactions from file '%s': %v", path, err)
+		return errFailure
+	}
+	if len(txs) == 0 {
+		log.Printf("[ERROR] No transactions in file '%s'", path)
+		return errFailure
+	}
+	log.Printf("[INFO] Broadcasting %d transactions from file '%s'", len(txs), path)
+	for _, tx := range txs {
+		id, err := tx.GetID(scheme)
+		if err != nil {
+			log.Printf("[ERROR] Failed to get transaction ID: %v", err)
+			return errFailure
+		}
+		d, err := crypto.NewDigestFromBytes(id)
+		if err != nil {
+			log.Printf("[ERROR] Invalid transaction ID: %v", err)
+			return errFailure
+		}
+		logWith(fields{"txId": d.String()}, "[INFO] Broadcasting transaction '%s'", d.String())
+		if err := broadcast(ctx, cl, tx, retries); err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, errUserTermination) {
+				return errUserTermination
+			}
+			log.Printf("[ERROR] Failed to broadcast transaction '%s': %v", d.String(), err)
+			return errFailure
+		}
+		if err := track(ctx, cl, d, opts); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return errUserTermination
+			}
+			log.Printf("[ERROR] Failed to track transaction '%s': %v", d.String(), err)
+			return errFailure
+		}
+	}
+	logWith(fields{"status": "ok"}, "[INFO] OK")
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build windows
+
+package main
+
+import "os"
+
+var interruptSignals = []os.Signal{os.Interrupt}
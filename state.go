@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+type spending struct {
+	Timestamp uint64 `json:"timestamp"`
+	Kind      string `json:"kind"`
+	TxID      string `json:"txId"`
+	Amount    uint64 `json:"amount"`
+}
+
+type leaseNote struct {
+	ID        string `json:"id"`
+	Recipient string `json:"recipient"`
+	Amount    uint64 `json:"amount"`
+	Timestamp uint64 `json:"timestamp"`
+	Expiry    uint64 `json:"expiry"`
+}
+
+// pendingTx is a broadcasted transaction that is not confirmed yet.
+type pendingTx struct {
+	Kind      string `json:"kind"`
+	TxID      string `json:"txId"`
+	Sender    string `json:"sender"`
+	Balance   uint64 `json:"balance,omitempty"`
+	Amount    uint64 `json:"amount"`
+	Timestamp uint64 `json:"timestamp"`
+}
+
+// runRecord is the outcome of the last successful run of a generating account.
+type runRecord struct {
+	Generator string        `json:"generator"`
+	Timestamp uint64        `json:"timestamp"`
+	Transfer  uint64        `json:"transfer"`
+	Leases    []leaseRecord `json:"leases,omitempty"`
+}
+
+type leaseRecord struct {
+	Recipient string `json:"recipient"`
+	Amount    uint64 `json:"amount"`
+}
+
+type state struct {
+	Spendings  []spending  `json:"spendings"`
+	LeaseNotes []leaseNote `json:"leaseNotes,omitempty"`
+	Pending    []pendingTx `json:"pending,omitempty"`
+	LastRuns   []runRecord `json:"lastRuns,omitempty"`
+}
+
+func loadState(path string) (*state, error) {
+	st := new(state)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return st, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func (s *state) save(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *state) spentSince(kind string, ts uint64) uint64 {
+	var total uint64
+	for _, r := range s.Spendings {
+		if r.Kind == kind && r.Timestamp >= ts {
+			total += r.Amount
+		}
+	}
+	return total
+}
+
+func (s *state) addSpending(kind, txID string, amount uint64) {
+	now := timestamp()
+	from := now - uint64(day.Milliseconds())
+	spendings := make([]spending, 0, len(s.Spendings)+1)
+	for _, r := range s.Spendings {
+		if r.Timestamp >= from {
+			spendings = append(spendings, r)
+		}
+	}
+	s.Spendings = append(spendings, spending{Timestamp: now, Kind: kind, TxID: txID, Amount: amount})
+}
+
+func (s *state) removeSpending(txID string) {
+	spendings := s.Spendings[:0]
+	for _, r := range s.Spendings {
+		if r.TxID != txID {
+			spendings = append(spendings, r)
+		}
+	}
+	s.Spendings = spendings
+}
+
+// dailyBudget returns the amount left to spend by transactions of the kind. Transfers and leases are counted
+// separately, because the lease usually moves the same WAVES that were transferred before.
+func (s *state) dailyBudget(kind string, limit uint64) uint64 {
+	spent := s.spentSince(kind, timestamp()-uint64(day.Milliseconds()))
+	if spent >= limit {
+		return 0
+	}
+	return limit - spent
+}
+
+func (s *state) addLeaseNote(id, recipient string, amount uint64, expiry time.Duration) {
+	now := timestamp()
+	s.LeaseNotes = append(s.LeaseNotes, leaseNote{
+		ID:        id,
+		Recipient: recipient,
+		Amount:    amount,
+		Timestamp: now,
+		Expiry:    now + uint64(expiry.Milliseconds()),
+	})
+}
+
+func (s *state) expiredLeaseNotes(ts uint64) []leaseNote {
+	var r []leaseNote
+	for _, n := range s.LeaseNotes {
+		if n.Expiry <= ts {
+			r = append(r, n)
+		}
+	}
+	return r
+}
+
+func (s *state) removeLeaseNote(id string) {
+	notes := s.LeaseNotes[:0]
+	for _, n := range s.LeaseNotes {
+		if n.ID != id {
+			notes = append(notes, n)
+		}
+	}
+	s.LeaseNotes = notes
+}
+
+func (s *state) addPending(kind, txID, sender string, balance, amount uint64) {
+	s.Pending = append(s.Pending, pendingTx{
+		Kind:      kind,
+		TxID:      txID,
+		Sender:    sender,
+		Balance:   balance,
+		Amount:    amount,
+		Timestamp: timestamp(),
+	})
+}
+
+func (s *state) pendingOf(sender string) []pendingTx {
+	var r []pendingTx
+	for _, p := range s.Pending {
+		if p.Sender == sender {
+			r = append(r, p)
+		}
+	}
+	return r
+}
+
+func (s *state) removePending(txID string) {
+	pending := s.Pending[:0]
+	for _, p := range s.Pending {
+		if p.TxID != txID {
+			pending = append(pending, p)
+		}
+	}
+	s.Pending = pending
+}
+
+// dropPending removes the transaction that never made it to blockchain, so its amount is not counted as spent.
+func (s *state) dropPending(txID string) {
+	s.removePending(txID)
+	s.removeSpending(txID)
+	s.removeLeaseNote(txID)
+}
+
+func (s *state) lastRun(generator string) *runRecord {
+	for i := range s.LastRuns {
+		if s.LastRuns[i].Generator == generator {
+			return &s.LastRuns[i]
+		}
+	}
+	return nil
+}
+
+func (s *state) setLastRun(r runRecord) {
+	if p := s.lastRun(r.Generator); p != nil {
+		*p = r
+		return
+	}
+	s.LastRuns = append(s.LastRuns, r)
+}
+
+// saveState writes the state to the state file unless it's a dry-run, which must leave the file as it is.
+func (c *cycle) saveState() error {
+	if c.dryRun {
+		return nil
+	}
+	return c.st.save(c.stateFile)
+}
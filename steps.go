@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Steps of the flow reported in StepError.
+const (
+	stepParameters = "parameters"
+	stepConnection = "connection"
+	stepScheme     = "scheme"
+	stepAccounts   = "accounts"
+	stepChecks     = "checks"
+	stepBroadcast  = "broadcast"
+	stepCancel     = "cancel"
+	stepUnwind     = "unwind"
+	stepRun        = "run"
+	stepTransfer   = "transfer"
+	stepLease      = "lease"
+)
+
+// StepError is the error of run with the step of the flow that failed. The cause is one of the sentinel errors
+// that define the exit code, possibly wrapping the underlying error.
+type StepError struct {
+	Step  string
+	Cause error
+}
+
+func (e *StepError) Error() string {
+	return e.Step + ": " + e.Cause.Error()
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Cause
+}
+
+// wrapStep attaches the step to the error unless the error already has one.
+func wrapStep(step string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var se *StepError
+	if errors.As(err, &se) {
+		return err
+	}
+	return &StepError{Step: step, Cause: err}
+}
+
+// failure makes errFailure carrying the underlying error.
+func failure(err error) error {
+	if errors.Is(err, errFailure) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", errFailure, err)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	"github.com/wavesplatform/gowaves/pkg/proto"
+)
+
+type leaseSummary struct {
+	Recipient string `json:"recipient"`
+	Amount    uint64 `json:"amount"`
+	TxID      string `json:"txId"`
+	rcp       proto.Recipient
+	fee       uint64
+}
+
+// summary collects the outcome of a run to report it at the end.
+type summary struct {
+	generator      proto.WavesAddress
+	lessor         proto.WavesAddress
+	dryRun         bool
+	withdrawal     string
+	transferAmount uint64
+	transferID     string
+	transferFee    uint64
+	leases         []leaseSummary
+	cancels        []leaseSummary
+	fees           uint64
+}
+
+func (s *summary) transfer(id string, amount, fee uint64) {
+	s.transferID = id
+	s.transferAmount = amount
+	s.transferFee = fee
+	s.fees += fee
+}
+
+func (s *summary) lease(id string, rcp proto.Recipient, amount, fee uint64) {
+	s.leases = append(s.leases, leaseSummary{Recipient: rcp.String(), Amount: amount, TxID: id, rcp: rcp, fee: fee})
+	s.fees += fee
+}
+
+func (s *summary) cancel(id string, rcp proto.Recipient, amount, fee uint64) {
+	s.cancels = append(s.cancels, leaseSummary{Recipient: rcp.String(), Amount: amount, TxID: id, rcp: rcp, fee: fee})
+	s.fees += fee
+}
+
+func (s *summary) print() {
+	if output == outputJSON {
+		f := fields{
+			"generator":      s.generator.String(),
+			"lessor":         s.lessor.String(),
+			"dryRun":         s.dryRun,
+			"transferAmount": s.transferAmount,
+			"transferTxId":   s.transferID,
+			"leases":         s.leases,
+			"cancelled":      len(s.cancels),
+			"fees":           s.fees,
+		}
+		if s.withdrawal != "" {
+			f["withdrawalAddress"] = s.withdrawal
+		}
+		logWith(f, "[INFO] Summary")
+		return
+	}
+	if s.dryRun {
+		log.Print("[INFO] Summary (DRY-RUN, nothing was broadcasted):")
+	} else {
+		log.Print("[INFO] Summary:")
+	}
+	log.Printf("[INFO]   Generator: %s", s.generator.String())
+	switch {
+	case s.withdrawal != "" && s.transferID != "":
+		log.Printf("[INFO]   Withdrawn: %s from lessor '%s' to '%s' by transaction '%s'", format(s.transferAmount), s.lessor.String(), s.withdrawal, s.transferID)
+	case s.withdrawal != "":
+		log.Printf("[INFO]   Withdrawn: nothing from lessor '%s'", s.lessor.String())
+	case s.transferID != "":
+		log.Printf("[INFO]   Transferred: %s to lessor '%s' by transaction '%s'", format(s.transferAmount), s.lessor.String(), s.transferID)
+	default:
+		log.Printf("[INFO]   Transferred: nothing to lessor '%s'", s.lessor.String())
+	}
+	if len(s.cancels) > 0 {
+		log.Printf("[INFO]   Cancelled leases: %d", len(s.cancels))
+	}
+	if len(s.leases) == 0 && s.withdrawal == "" {
+		log.Print("[INFO]   Leased: nothing")
+	}
+	for _, l := range s.leases {
+		log.Printf("[INFO]   Leased: %s to '%s' by transaction '%s'", format(l.Amount), l.Recipient, l.TxID)
+	}
+	if s.dryRun {
+		log.Printf("[INFO] Total fees this run: %s (would be paid)", format(s.fees))
+	} else {
+		log.Printf("[INFO] Total fees this run: %s", format(s.fees))
+	}
+}
+
+type accountTotal struct {
+	Generator   string `json:"generator"`
+	Status      string `json:"status"`
+	Transferred uint64 `json:"transferred"`
+	Leased      uint64 `json:"leased"`
+	Fees        uint64 `json:"fees"`
+}
+
+// printTotals reports the outcome of runs of several generating accounts.
+func printTotals(sums []*summary, errs []error) {
+	var (
+		accounts                  = make([]accountTotal, len(sums))
+		transferred, leased, fees uint64
+	)
+	for i, s := range sums {
+		a := accountTotal{Generator: s.generator.String(), Status: "ok", Transferred: s.transferAmount, Fees: s.fees}
+		switch {
+		case errs[i] == nil:
+		case errors.Is(errs[i], errBelowThreshold):
+			a.Status = "below threshold"
+		default:
+			a.Status = "failed"
+		}
+		for _, l := range s.leases {
+			a.Leased += l.Amount
+		}
+		transferred += a.Transferred
+		leased += a.Leased
+		fees += a.Fees
+		accounts[i] = a
+	}
+	if output == outputJSON {
+		logWith(fields{
+			"accounts":    accounts,
+			"transferred": transferred,
+			"leased":      leased,
+			"fees":        fees,
+		}, "[INFO] Totals")
+		return
+	}
+	log.Printf("[INFO] Totals of %d generating accounts:", len(sums))
+	for _, a := range accounts {
+		log.Printf("[INFO]   %s: %s, transferred %s, leased %s, fees %s",
+			a.Generator, a.Status, format(a.Transferred), format(a.Leased), format(a.Fees))
+	}
+	log.Printf("[INFO]   Transferred: %s", format(transferred))
+	log.Printf("[INFO]   Leased: %s", format(leased))
+	log.Printf("[INFO]   Total fees: %s", format(fees))
+}
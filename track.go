@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/wavesplatform/gowaves/pkg/crypto"
+	"github.com/wavesplatform/gowaves/pkg/proto"
+)
+
+// creditChecks is the number of attempts to see the transferred amount on the recipient's balance.
+const creditChecks = 5
+
+var (
+	errNotFound        = errors.New("not found")
+	errRequestRejected = errors.New("request rejected by node")
+	errTxFailed        = errors.New("transaction failed")
+)
+
+// trackErrorRetries is the number of consecutive transient errors of node tolerated while tracking a transaction.
+const trackErrorRetries = 3
+
+type transactionStatus struct {
+	ID                crypto.Digest `json:"id"`
+	Height            uint64        `json:"height"`
+	ApplicationStatus string        `json:"applicationStatus,omitempty"`
+}
+
+type trackOptions struct {
+	initialDelay    time.Duration
+	timeout         time.Duration
+	pollInterval    time.Duration
+	maxPollInterval time.Duration
+	confirmations   int
+}
+
+// track waits for transaction to appear on blockchain and to get the required number of confirmations.
+// The block with transaction is the first confirmation. If the transaction disappears from blockchain while
+// waiting for confirmations errRolledBack is returned. Once the transaction is in block the interval between checks
+// doubles up to the maximum poll interval, because the next confirmation takes a block anyway.
+func track(ctx context.Context, cl *node, id crypto.Digest, opts trackOptions) error {
+	log.Printf("[INFO] Waiting for transaction '%s' on blockchain...", id.String())
+	start := time.Now()
+	tctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+	appeared := false
+	failures := 0
+	interval := opts.pollInterval
+	err := func() error {
+		if opts.initialDelay > 0 {
+			select {
+			case <-tctx.Done():
+				return tctx.Err()
+			case <-time.After(opts.initialDelay):
+			}
+		}
+		for {
+			st, err := getTransactionStatus(tctx, cl, id)
+			if err == nil || errors.Is(err, errNotFound) {
+				failures = 0
+			}
+			switch {
+			case err == nil:
+				if st.ApplicationStatus != "" && st.ApplicationStatus != "succeeded" {
+					log.Printf("[ERROR] Transaction '%s' is stored on blockchain with application status '%s'", id.String(), st.ApplicationStatus)
+					return errTxFailed
+				}
+				if !appeared && opts.confirmations > 1 {
+					log.Printf("[INFO] Transaction '%s' is in block at height %d, waiting for %d confirmations...",
+						id.String(), st.Height, opts.confirmations)
+				}
+				appeared = true
+				if opts.confirmations <= 1 {
+					return nil
+				}
+				h, err := getHeight(tctx, cl)
+				if err == nil && h >= st.Height && h-st.Height+1 >= uint64(opts.confirmations) {
+					log.Printf("[INFO] Transaction '%s' has %d confirmations", id.String(), h-st.Height+1)
+					return nil
+				}
+			case errors.Is(err, errNotFound) && appeared:
+				log.Printf("[ERROR] Transaction '%s' disappeared from blockchain", id.String())
+				return errRolledBack
+			case errors.Is(err, errNotFound):
+				debugf("Transaction '%s' is not on blockchain yet, still waiting", id.String())
+			case tctx.Err() != nil:
+				return tctx.Err()
+			case errors.Is(err, errRequestRejected):
+				log.Printf("[ERROR] Node rejected the request of transaction '%s' status: %v", id.String(), err)
+				return errFailure
+			default:
+				failures++
+				if failures > trackErrorRetries {
+					log.Printf("[ERROR] Node failed to return status of transaction '%s' %d times in a row: %v", id.String(), failures, err)
+					return errFailure
+				}
+				log.Printf("[WARN] Node failed to return status of transaction '%s' (%d of %d), still waiting: %v",
+					id.String(), failures, trackErrorRetries, err)
+			}
+			if tctx.Err() != nil {
+				return tctx.Err()
+			}
+			if appeared && interval < opts.maxPollInterval {
+				interval *= 2
+				if interval > opts.maxPollInterval {
+					interval = opts.maxPollInterval
+				}
+				debugf("Next check of transaction '%s' in %s", id.String(), interval)
+			}
+			select {
+			case <-tctx.Done():
+				return tctx.Err()
+			case <-time.After(interval):
+			}
+		}
+	}()
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		if appeared {
+			log.Printf("[ERROR] Transaction '%s' did not get %d confirmations after %s", id.String(), opts.confirmations, time.Since(start).Round(time.Second))
+		} else {
+			log.Printf("[ERROR] Transaction '%s' did not appear on blockchain after %s", id.String(), time.Since(start).Round(time.Second))
+		}
+		return errConfirmationTimeout
+	}
+	return err
+}
+
+func getTransactionStatus(ctx context.Context, cl *node, id crypto.Digest) (*transactionStatus, error) {
+	if cl.grpc != nil {
+		st, err := cl.grpc.transactionStatus(ctx, id)
+		if err != nil && !errors.Is(err, errNotFound) && !isTransient(nil, err) && ctx.Err() == nil {
+			return nil, fmt.Errorf("%w: %v", errRequestRejected, err)
+		}
+		return st, err
+	}
+	infoRequest, err := http.NewRequest("GET", cl.GetOptions().BaseUrl+"/transactions/info/"+id.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	st := new(transactionStatus)
+	resp, err := cl.Do(ctx, infoRequest, st)
+	if err != nil {
+		if resp != nil && resp.Response != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, errNotFound
+		}
+		if !isTransient(resp, err) {
+			return nil, fmt.Errorf("%w: %v", errRequestRejected, err)
+		}
+		return nil, err
+	}
+	return st, nil
+}
+
+func getHeight(ctx context.Context, cl *node) (uint64, error) {
+	if cl.grpc != nil {
+		return cl.grpc.height(ctx)
+	}
+	h, _, err := cl.Blocks.Height(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return h.Height, nil
+}
+
+// waitCredited checks that the available balance of recipient has grown by the credited amount since it was
+// taken before the transaction. A node behind a load balancer may return the balance from a lagging node even after
+// the transaction is confirmed, so the balance is polled a few times. Difference of one standard fee is tolerated
+// in case the recipient has spent something in between.
+func waitCredited(ctx context.Context, cl *node, addr proto.WavesAddress, before, amount uint64, opts trackOptions) error {
+	total, err := addAmounts(before, amount)
+	if err != nil {
+		return err
+	}
+	expected := deduct(total, standardFee)
+	var balance uint64
+	for i := 1; ; i++ {
+		balance, err = getAvailableWavesBalance(ctx, cl, addr)
+		if err != nil {
+			return err
+		}
+		if balance >= expected {
+			return nil
+		}
+		if i >= creditChecks {
+			break
+		}
+		log.Printf("[INFO] Balance %s of '%s' does not reflect the credited amount yet, expected at least %s, checking again...",
+			format(balance), addr.String(), format(expected))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(opts.pollInterval):
+		}
+	}
+	log.Printf("[ERROR] Balance %s of '%s' did not reflect the credited amount %s after %d checks, node's state may lag behind",
+		format(balance), addr.String(), format(amount), creditChecks)
+	return errNotCredited
+}
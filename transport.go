@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strings"
+)
+
+// headers is a repeatable flag of HTTP headers in form 'Name: Value'.
+// Values are not shown by String to keep secrets like API keys out of logs and usage.
+type headers http.Header
+
+func (h *headers) String() string {
+	if h == nil || *h == nil {
+		return ""
+	}
+	names := make([]string, 0, len(*h))
+	for n := range *h {
+		names = append(names, n)
+	}
+	return strings.Join(names, ", ")
+}
+
+func (h *headers) Set(s string) error {
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return errors.New("header must be in form 'Name: Value'")
+	}
+	name, value := strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+	if name == "" || strings.IndexFunc(name, func(r rune) bool { return !isTokenChar(r) }) >= 0 {
+		return fmt.Errorf("invalid header name '%s'", name)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("invalid value of header '%s'", name)
+	}
+	if *h == nil {
+		*h = make(headers)
+	}
+	http.Header(*h).Add(textproto.CanonicalMIMEHeaderKey(name), value)
+	return nil
+}
+
+func isTokenChar(r rune) bool {
+	return r < 0x7f && r > 0x20 && !strings.ContainsRune("\"(),/:;<=>?@[\\]{}", r)
+}
+
+// headerTransport adds the headers to every request.
+type headerTransport struct {
+	base   http.RoundTripper
+	header http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	for n, vs := range t.header {
+		r.Header.Del(n)
+		for _, v := range vs {
+			r.Header.Add(n, v)
+		}
+	}
+	return t.base.RoundTrip(r)
+}
+
+const maxDebugBodySize = 4096
+
+// debugTransport logs requests and raw responses, headers are not logged to keep API keys out of logs.
+type debugTransport struct {
+	base http.RoundTripper
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	debugf("%s %s", req.Method, req.URL.String())
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		debugf("%s %s failed: %v", req.Method, req.URL.String(), err)
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if len(body) > maxDebugBodySize {
+		debugf("Response %s from %s: %s... (%d bytes)", resp.Status, req.URL.String(), body[:maxDebugBodySize], len(body))
+	} else {
+		debugf("Response %s from %s: %s", resp.Status, req.URL.String(), body)
+	}
+	return resp, nil
+}
+
+// tlsConfig makes TLS configuration that trusts certificates of CA from the PEM file in addition to system ones,
+// or does not verify certificates at all if insecure.
+func tlsConfig(insecure bool, caFile string) (*tls.Config, error) {
+	if insecure && caFile != "" {
+		return nil, errors.New("CA file is useless with disabled verification")
+	}
+	c := &tls.Config{MinVersion: tls.VersionTLS12}
+	if insecure {
+		c.InsecureSkipVerify = true
+		return c, nil
+	}
+	b, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates found in file '%s'", caFile)
+	}
+	c.RootCAs = pool
+	return c, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/wavesplatform/gowaves/pkg/proto"
+)
+
+// unwind reverses the normal flow: it cancels all active leases of lessor and transfers the freed balance
+// to the withdrawal address.
+func (c *cycle) unwind(ctx context.Context, to proto.Recipient) error {
+	c.sum = &summary{generator: c.gAddr, lessor: c.lAddr, dryRun: c.dryRun, withdrawal: to.String()}
+	defer c.sum.print()
+
+	leases, err := getActiveLeases(ctx, c.cl, c.lAddr)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return errUserTermination
+		}
+		log.Printf("[ERROR] Failed to get active leases of lessor: %v", err)
+		return errFailure
+	}
+	leased, err := totalLeased(leases)
+	if err != nil {
+		log.Printf("[ERROR] Invalid total of active leases: %v", err)
+		return errFailure
+	}
+	log.Printf("[INFO] Lessor has %d active leases of total %s", len(leases), format(leased))
+	extraFee, err := getExtraFee(ctx, c.cl, c.lAddr)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return errUserTermination
+		}
+		log.Printf("[ERROR] Failed to check extra fee on account '%s': %v", c.lAddr.String(), err)
+		return errFailure
+	}
+	cancelFee, err := addAmounts(standardFee, extraFee)
+	if err != nil {
+		log.Printf("[ERROR] Invalid lease cancel fee: %v", err)
+		return errFailure
+	}
+	freed, err := c.cancelLeases(ctx, leases, cancelFee)
+	if err != nil {
+		return err
+	}
+
+	balance, err := getAvailableWavesBalance(ctx, c.cl, c.lAddr)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return errUserTermination
+		}
+		log.Printf("[ERROR] Failed to get lessor account's WAVES balance: %v", err)
+		return errFailure
+	}
+	if c.dryRun && len(leases) > 0 { // Balance is not affected by cancels in dry-run, so add the amount they would free
+		log.Printf("[INFO] DRY-RUN: Balance of lessor account would increase by %s after cancelling leases", format(freed))
+		balance, err = addAmounts(balance, freed)
+		if err != nil {
+			log.Printf("[ERROR] Invalid lessor's balance: %v", err)
+			return errFailure
+		}
+	}
+	logWith(fields{"address": c.lAddr.String(), "amount": balance},
+		"[INFO] Balance of lessor account '%s': %s", c.lAddr.String(), format(balance))
+	if c.irreducibleBalance > 0 {
+		explainf("Lessor's available balance %s minus irreducible balance %s leaves %s",
+			format(balance), format(uint64(c.irreducibleBalance)), format(deduct(balance, uint64(c.irreducibleBalance))))
+		balance = deduct(balance, uint64(c.irreducibleBalance))
+	}
+	if c.sponsorshipReserve > 0 {
+		explainf("Lessor's balance %s minus sponsorship reserve %s leaves %s",
+			format(balance), format(uint64(c.sponsorshipReserve)), format(deduct(balance, uint64(c.sponsorshipReserve))))
+		balance = deduct(balance, uint64(c.sponsorshipReserve))
+	}
+	if c.lessorFeeReserve > 0 {
+		explainf("Lessor's balance %s minus fee reserve %s leaves %s",
+			format(balance), format(uint64(c.lessorFeeReserve)), format(deduct(balance, uint64(c.lessorFeeReserve))))
+		balance = deduct(balance, uint64(c.lessorFeeReserve))
+	}
+	fee, err := addAmounts(standardFee, extraFee)
+	if err != nil {
+		log.Printf("[ERROR] Invalid transfer fee: %v", err)
+		return errFailure
+	}
+	fee, err = c.fee(ctx, proto.NewUnsignedTransferWithProofs(c.txVer, c.lPK, na, na, c.timestamp(), balance, fee, to, nil), fee, "transfer")
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return errUserTermination
+		}
+		log.Printf("[ERROR] Invalid transfer fee: %v", err)
+		return errFailure
+	}
+	if balance <= fee {
+		explainf("Lessor's balance %s does not exceed transfer fee %s", format(balance), format(fee))
+		log.Printf("[INFO] Lessor's balance %s is not enough to pay transfer fee %s, nothing to withdraw", format(balance), format(fee))
+		logWith(fields{"status": "ok"}, "[INFO] OK")
+		return nil
+	}
+	amount := balance - fee
+	explainf("Withdrawal amount is balance %s minus fee %s, total %s", format(balance), format(fee), format(amount))
+	transfer := proto.NewUnsignedTransferWithProofs(c.txVer, c.lPK, na, na, c.timestamp(), amount, fee, to, nil)
+	if err := transfer.Sign(c.scheme, c.lSK); err != nil {
+		log.Printf("[ERROR] Failed to sign transfer transaction: %v", err)
+		return errFailure
+	}
+	if c.dryRun {
+		b, err := json.Marshal(transfer)
+		if err != nil {
+			log.Printf("[ERROR] Failed to make transaction json: %v", err)
+			return errFailure
+		}
+		log.Printf("[INFO] Transfer transaction:\n%s", string(b))
+		logWith(fields{"txId": transfer.ID.String(), "amount": amount, "fee": fee, "address": to.String()},
+			"[INFO] DRY-RUN: Withdrawal transaction ID: %s", transfer.ID.String())
+		if err := c.writeOut(transfer); err != nil {
+			log.Printf("[ERROR] Failed to write transfer transaction: %v", err)
+			return errFailure
+		}
+		c.sum.transfer(transfer.ID.String(), amount, fee)
+		logWith(fields{"status": "ok"}, "[INFO] OK")
+		return nil
+	}
+	logWith(fields{"txId": transfer.ID.String(), "amount": amount, "fee": fee, "address": to.String()},
+		"[INFO] Withdrawal transaction ID: %s", transfer.ID.String())
+	if c.explorerURL != "" {
+		log.Printf("[INFO] Withdrawal transaction in explorer: %s", explorerLink(c.explorerURL, *transfer.ID))
+	}
+	err = broadcast(ctx, c.cl, transfer, c.broadcastRetries)
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, errUserTermination) {
+			return errUserTermination
+		}
+		log.Printf("[ERROR] Failed to broadcast transfer transaction: %v", err)
+		return errFailure
+	}
+	c.sum.transfer(transfer.ID.String(), amount, fee)
+	err = track(ctx, c.cl, *transfer.ID, c.tracking)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return errUserTermination
+		}
+		log.Printf("[ERROR] Failed to track transfer transaction: %v", err)
+		return errFailure
+	}
+	logWith(fields{"status": "ok"}, "[INFO] OK")
+	return nil
+}
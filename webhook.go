@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const webhookTimeout = 10 * time.Second
+
+type webhookPayload struct {
+	Status         string         `json:"status"`
+	Text           string         `json:"text"`
+	Content        string         `json:"content"`
+	Generator      string         `json:"generator,omitempty"`
+	Lessor         string         `json:"lessor,omitempty"`
+	DryRun         bool           `json:"dryRun"`
+	TransferTxID   string         `json:"transferTxId,omitempty"`
+	TransferAmount uint64         `json:"transferAmount"`
+	Leases         []leaseSummary `json:"leases"`
+	Fees           uint64         `json:"fees"`
+	Error          string         `json:"error,omitempty"`
+}
+
+// webhook posts JSON notifications to the given URL. Text of the notification is put in both 'text' and 'content'
+// fields, so Slack and Discord incoming webhooks can display it. Methods are safe to call on nil webhook.
+type webhook struct {
+	url      string
+	hc       *http.Client
+	notified bool
+}
+
+func newWebhook(url string) *webhook {
+	return &webhook{url: url, hc: &http.Client{Timeout: webhookTimeout}}
+}
+
+func (w *webhook) send(ctx context.Context, p webhookPayload) {
+	if w == nil {
+		return
+	}
+	w.notified = true
+	p.Content = p.Text
+	if p.Leases == nil {
+		p.Leases = []leaseSummary{}
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("[WARN] Failed to make webhook notification: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", w.url, bytes.NewReader(b))
+	if err != nil {
+		log.Printf("[WARN] Failed to make webhook request: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.hc.Do(req)
+	if err != nil {
+		log.Printf("[WARN] Failed to send webhook notification: %v", err)
+		return
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		log.Printf("[WARN] Webhook responded with status '%s'", resp.Status)
+	}
+}
+
+// result notifies about the outcome of a run described by the summary.
+func (w *webhook) result(ctx context.Context, s *summary, err error) {
+	if w == nil {
+		return
+	}
+	p := webhookPayload{
+		Generator:      s.generator.String(),
+		Lessor:         s.lessor.String(),
+		DryRun:         s.dryRun,
+		TransferTxID:   s.transferID,
+		TransferAmount: s.transferAmount,
+		Leases:         s.leases,
+		Fees:           s.fees,
+	}
+	var sb strings.Builder
+	sb.WriteString("Waves Automatic Lessor")
+	if s.dryRun {
+		sb.WriteString(" (dry-run)")
+	}
+	if err != nil {
+		p.Status = "failure"
+		p.Error = err.Error()
+		_, _ = fmt.Fprintf(&sb, ": failure, %v", err)
+	} else {
+		p.Status = "ok"
+		sb.WriteString(": OK")
+	}
+	if s.transferID != "" {
+		_, _ = fmt.Fprintf(&sb, ", transferred %s", format(s.transferAmount))
+	}
+	for _, l := range s.leases {
+		_, _ = fmt.Fprintf(&sb, ", leased %s to %s", format(l.Amount), l.Recipient)
+	}
+	p.Text = sb.String()
+	w.send(ctx, p)
+}
+
+// failure notifies about the failure that happened before any run was made.
+func (w *webhook) failure(err error) {
+	if w == nil || w.notified {
+		return
+	}
+	w.send(context.Background(), webhookPayload{
+		Status: "failure",
+		Text:   fmt.Sprintf("Waves Automatic Lessor: failure, %v", err),
+		Error:  err.Error(),
+	})
+}
+
+func (w *webhook) alert(ctx context.Context, text string) {
+	if w == nil {
+		return
+	}
+	w.send(ctx, webhookPayload{Status: "alert", Text: "Waves Automatic Lessor: " + text})
+}